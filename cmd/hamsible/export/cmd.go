@@ -17,6 +17,9 @@ var (
 	roleName          string
 	generateFilters   bool
 	emitKeysSnakeCase bool
+	operator          bool
+	goTruthiness      bool
+	goTruthinessPaths []string
 )
 
 func GetExportCmd() *cobra.Command {
@@ -31,6 +34,9 @@ func GetExportCmd() *cobra.Command {
 	exportCmd.Flags().StringVar(&workspace, "workspace", "workspace", "workspace to generate exported ansible role.")
 	exportCmd.Flags().BoolVar(&generateFilters, "generateFilters", false,"whether or not to install Ansible Filter scaffolding")
 	exportCmd.Flags().BoolVar(&emitKeysSnakeCase, "emitKeysSnakeCase", true, "whether or not to convert Ansible keys to snake_case")
+	exportCmd.Flags().BoolVar(&operator, "operator", false, "whether or not to bind the release to the custom resource of an Ansible Operator")
+	exportCmd.Flags().BoolVar(&goTruthiness, "goTruthiness", false, "whether or not to test values in if conditions with Go truthiness, which treats empty values as false")
+	exportCmd.Flags().StringSliceVar(&goTruthinessPaths, "goTruthinessPaths", nil, "paths of values (i.e., ingress.tls) to test in if conditions with Go truthiness")
 	return exportCmd
 }
 
@@ -47,6 +53,8 @@ func exportFunc(cmd *cobra.Command, args []string) error {
 		return err
 	}
 	j2parse.ReplaceWithSnakeCase = emitKeysSnakeCase
+	j2parse.GoTruthiness = goTruthiness
+	j2parse.GoTruthinessPaths = goTruthinessPaths
 	helm.HelmChartRef = helmChartRef
 	err := chartClient.LoadChartFrom(helmChartRef)
 
@@ -67,17 +75,18 @@ func exportFunc(cmd *cobra.Command, args []string) error {
 	ansiblegalaxy.InstallAnsibleRole(roleName, workspace)
 	convert.CopyTemplates(helmChartRef, roleDirectory)
 	convert.CopyValuesToDefaults(helmChartRef, roleDirectory)
-	convert.RemoveValuesReferencesInDefaults(roleDirectory)
 	if emitKeysSnakeCase {
 		log.Info("Locating keys that should be converted to snake_case")
 		keySet := convert.ConvertDefaultsToSnakeCase(chartClient, roleDirectory)
 		j2parse.KnownTextNodeSubstitutions = *keySet
 	}
-	convert.SuppressWhitespaceTrimmingInTemplates(roleDirectory)
-	convert.ConvertControlFlowSyntax(roleDirectory)
+	convert.ConvertTemplateStringsInDefaults(roleDirectory)
+	convert.RemoveValuesReferencesInDefaults(roleDirectory)
+	convert.AddBuiltinObjectDefaults(chartClient, roleDirectory, operator)
+	generatedValues := convert.ConvertControlFlowSyntax(roleDirectory)
 	convert.RemoveValuesReferencesInTemplates(roleDirectory)
-	// generate the task, which just renders the templates
-	convert.InstallAnsibleTasks(roleDirectory)
+	// generate the task, which reads the generated values of existing Secrets and renders the templates
+	convert.InstallAnsibleTasks(roleDirectory, generatedValues)
 
 	// Since Sprig Ansible Filters are not fully implemented, generateFilters CLI argument controls whether or not to
 	// install the stub filters.
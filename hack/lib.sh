@@ -25,15 +25,12 @@ EOL
   for file in $(find "$source/defaults" -iname '*.yml' -type f -printf "%P\n"); do
     cp "$source/defaults/$file" "$dst/roles/$role/defaults/${file}"
     sudo chmod 660 "$dst/roles/$role/defaults/${file}"
-    add_chart_variables_to_values "$dst/roles/$role/defaults/${file}"
   done
 
   #Templates
   for file in $(find "$source/templates" -iname '*.j2' -type f -printf "%P\n"); do
     cp "$source/templates/$file" "$dst/roles/$role/templates/${file}"
     sudo chmod 660 "$dst/roles/$role/templates/${file}"
-    #Temporary Solution For Template and Includes
-    replace_chart_values_in_files "$dst/roles/$role/templates/${file}"
     if [[ "$role" == "zetcd" ]]; then
       replace_in_templates_for_zetcd "$dst/roles/$role/templates/${file}"
     fi
@@ -43,8 +40,6 @@ EOL
   for file in $(find "$source/tasks" -iname '*.yml' -type f -printf "%P\n"); do
     cp "$source/tasks/$file" "$dst/roles/$role/tasks/${file}"
     sudo chmod 660 "$dst/roles/$role/tasks/${file}"
-    #Temporary Solution For Template and Includes
-    replace_chart_values_in_files "$dst/roles/$role/tasks/${file}"
   done
 }
 usage() {
@@ -59,7 +54,8 @@ usage() {
 }
 
 export_helm() {
-  make -C "$base_dir" example 2>&1
+  #Bind the release to the custom resource of the operator
+  make -C "$base_dir" example export_flags=--operator=true 2>&1
   if [[ "${?}" -ne 0 ]]; then
     echo "Could not export helm template due to above error.(Possible solution , run make clean)"
     exit 1
@@ -94,64 +90,22 @@ validate() {
     exit 1
   fi
 }
-#Create Chart.Name, Release.Varsion in dfault varaible files
-replace_chart_values_in_files() {
-  local file="${1}"
-  #for mac os adding '' and -e
-  sed -i.bak "s/.Chart./chart./g" "$file"
-  sed -i.bak "s/.Release./release./g" "$file"
-  rm "${file}.bak" #for mac os
-}
-
-#Add Chart.Name, Release.Varsion to default varaible files
-add_chart_variables_to_values() {
-  local file=${1}
-  cat >>"$file" <<EOL
-#Added from template exporter
-chart:
-  name: $role
-  version: 1.0.0
-release:
-  name: $role
-  service:
-EOL
-}
-
 # This is for zetcd only - fixing the manual process
 replace_in_templates_for_zetcd() {
   local file=${1}
   declare -A ChangeLogMessage=(
-    ["template \"zetcd.fullname\" \."]=" Template is not support now , so use Chart name"
-    ["template \"zetcd.name\" \."]=" Template is not support now , so use Chart name"
-    ["replace \"+\" \"_\""]="Replace filter needs parentheses."
-    ["{{ index .Values \"etcd-operator\" \"cluster\" \"name\" }}"]="Indexing values ,right way is to replace it by \\
-                                                                    etcd-operator.cluster.name, but .name field is not available in values?? \\
-                                                                    used random value for testing. This can be tricky."
-    ["toYaml nodeSelector | indent 8"]="filters have to be piped and args are passed between paratheses"
-    ["{{ toYaml resources | indent 12 }}"]="This needed condition check or else it will print empty {} \\
-                                            which invalidates yaml"
-    ["toYaml nodeSelector | indent 8"]="filters have to be piped and args are passed between paratheses"
     ["apiVersion: extensions\/v1beta1"]="k8s 1.6 depricated Deployment in the extensions\/v1beta1, \\
                                           apps\/v1beta1,So replaced it with apps\/v1"
-    ["replicas: {{ replicaCount }}"]="spec.selector is required field as per  apps\/v1 spec and was missing."
+    ["replicas: {{ replica_count }}"]="spec.selector is required field as per  apps\/v1 spec and was missing."
 
   )
 
   declare -A postProcessing=(
-    ["template \"zetcd.fullname\" \."]="chart.name"
-    ["template \"zetcd.name\" \."]="chart.name"
-    ["replace \"+\" \"_\""]="replace (\"+\",\"_\")"
-    ["{{ index .Values \"etcd-operator\" \"cluster\" \"name\" }}"]="localhost" #"etcd-operator.cluster.name"
-    ["{{ toYaml resources | indent 12 }}"]="{% if resources is defined and resources|length %}\\
-                                                      {{ resources | to_yaml | indent (12) }}\\
-                                                      {% endif %}"
-    ["toYaml nodeSelector | indent 8"]="nodeSelector | to_yaml | indent (8)"
-    ["{% if nodeSelector is defined %}"]="{% if nodeSelector is defined and nodeSelector|length %}"
     ["apiVersion: extensions\/v1beta1"]="apiVersion: apps\/v1"
-    ["replicas: {{ replicaCount }}"]="replicas: {{ replicaCount }} \\
+    ["replicas: {{ replica_count }}"]="replicas: {{ replica_count }} \\
   selector: \\
     matchLabels: \\
-      app: {{ chart.name }}"
+      app: {{ chart_name }}"
 
   )
 
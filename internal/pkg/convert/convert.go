@@ -16,10 +16,13 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	upstreamtemplate "text/template"
 )
 
+const ansibleOperatorMeta = "ansible_operator_meta"
 const ansibleRoleFilterPluginsDirectory = "filter_plugins"
 const ansibleRoleDefaultsDirectory = "defaults"
 const ansibleRoleTemplatesDirectory = "templates"
@@ -28,14 +31,21 @@ const ansibleRoleTasksDirectory = "tasks"
 const ansibleTasksTemplateLeftDelimiter = "{{{"
 const ansibleTasksTemplateLocation = "internal/pkg/helm/templates/tasks/main.yml"
 const ansibleTasksTemplateRightDelimiter = "}}}"
+const builtinObjectsDefaultsHeader = "\n# Helm builtin objects, such as .Release.Name and .Chart.Version\n"
 const defaultDirectoryPermissions = 0777
 const defaultPermissions = 0660
 const filtersDirectory = "internal/filters"
+const helmDefaultNamespace = "default"
 const helmDefaultsContainsSelfReference =
 	"# TODO: Replace \".Values.\" reference with a literal, as Ansible Playbook doesn't allow self-reference\n"
 const HelmTemplatesDirectory = "templates"
+const helmPartialFilePrefix = "_"
+const helmReleaseService = "Helm"
+const helmTemplateHelperSuffix = "tpl"
 const helmValuesFilePrefix = "values"
 const j2Extension = "j2"
+const jinja2TrimBlocksOverride = "#jinja2: trim_blocks: False\n"
+const goTemplateLeftDelimiter = "{{"
 const valuesString = ".Values."
 const yamlSuffix = "yaml"
 const ymlSuffix = "yml"
@@ -117,13 +127,26 @@ func isYamlFile(fileName string) bool {
 	return strings.HasSuffix(fileName, yamlSuffix) || strings.HasSuffix(fileName, ymlSuffix)
 }
 
+// Extract whether a fileName represents a Helm template helper file, such as "_helpers.tpl".  This function does not
+// check for file existence.
+func isHelmTemplateHelperFile(fileName string) bool {
+	return strings.HasSuffix(fileName, "."+helmTemplateHelperSuffix)
+}
+
+// Extract whether a fileName represents a Helm partial.  By Helm convention, files in the templates directory that begin
+// with an underscore are not rendered as manifests;  they only contribute template definitions.
+func isHelmPartialFile(fileName string) bool {
+	return strings.HasPrefix(fileName, helmPartialFilePrefix)
+}
+
 // Translates a YAML fileName into a Jinja2 fileName
 func yamlToJ2FileName(fileName string) string {
 	return fileName + "." + j2Extension
 }
 
-// Copies Helm Yaml templates to the appropriate Ansible Playbook roles template, post-fixing each YAML file with a
-// ".j2" extension.  The path to the ansible playbook templates directory is returned.
+// Copies Helm Yaml templates and template helpers (i.e., "_helpers.tpl") to the appropriate Ansible Playbook roles
+// template, post-fixing each file with a ".j2" extension.  The path to the ansible playbook templates directory is
+// returned.
 func CopyTemplates(helmChartRootDirectory string, rolesDirectory string) string {
 	chartTemplatesDir := getHelmChartTemplatesDirectory(helmChartRootDirectory)
 	checkDirectoryExistence(chartTemplatesDir, "Cannot read the template directory")
@@ -132,7 +155,7 @@ func CopyTemplates(helmChartRootDirectory string, rolesDirectory string) string
 	files, _ := readDir(chartTemplatesDir)
 	for _, file := range files {
 		fileName := file.Name()
-		if isYamlFile(fileName) {
+		if isYamlFile(fileName) || isHelmTemplateHelperFile(fileName) {
 			chartTemplateFileName := filepath.Join(chartTemplatesDir, fileName)
 			contents, err := ioutil.ReadFile(chartTemplateFileName)
 			j2FileName := yamlToJ2FileName(fileName)
@@ -191,6 +214,121 @@ func CopyValuesToDefaults(chartRoot string, roleDirectory string) {
 	appendFile(string(contents), rolesDefaultsFileName)
 }
 
+// Returns the defaults of the role variables which replace the Helm builtin objects (see
+// j2parse.BuiltinObjectVariables), ordered as they are written to defaults/main.yml.  Chart fields are derived from
+// Chart.yaml, and the release is named after the chart.  When the role is run by an Ansible Operator, the release is
+// instead bound to the name and namespace of the custom resource.
+func getBuiltinObjectDefaults(chartClient *helm.HelmChartClient, operator bool) [][2]string {
+	metadata := chartClient.Chart.Metadata
+	releaseName := strconv.Quote(metadata.GetName())
+	releaseNamespace := strconv.Quote(helmDefaultNamespace)
+	if operator {
+		releaseName = strconv.Quote("{{ " + ansibleOperatorMeta + ".name }}")
+		releaseNamespace = strconv.Quote("{{ " + ansibleOperatorMeta + ".namespace }}")
+	}
+	return [][2]string{
+		{"Release.Name", releaseName},
+		{"Release.Namespace", releaseNamespace},
+		{"Release.Service", strconv.Quote(helmReleaseService)},
+		{"Chart.Name", strconv.Quote(metadata.GetName())},
+		{"Chart.Version", strconv.Quote(metadata.GetVersion())},
+		{"Chart.AppVersion", strconv.Quote(metadata.GetAppVersion())},
+		{"Template.BasePath", strconv.Quote(path.Join(metadata.GetName(), HelmTemplatesDirectory))},
+	}
+}
+
+// Adds the defaults of the role variables which replace the Helm builtin objects, such as ".Release.Name" and
+// ".Chart.Version", to defaults/main.yml.
+func AddBuiltinObjectDefaults(chartClient *helm.HelmChartClient, roleDirectory string, operator bool) {
+	defaultsFileName := getAnsibleRoleDefaultsFileName(roleDirectory)
+	var sb strings.Builder
+	sb.WriteString(builtinObjectsDefaultsHeader)
+	for _, field := range getBuiltinObjectDefaults(chartClient, operator) {
+		sb.WriteString(j2parse.BuiltinObjectVariables[field[0]] + ": " + field[1] + "\n")
+	}
+
+	file, err := os.OpenFile(defaultsFileName, os.O_APPEND|os.O_WRONLY, defaultPermissions)
+	if err != nil {
+		logrus.Warnf("Skipping defaults of Helm builtin objects, couldn't open file: %s", defaultsFileName)
+		return
+	}
+	defer file.Close()
+	if _, err := file.WriteString(sb.String()); err != nil {
+		logrus.Warnf("Skipping defaults of Helm builtin objects, couldn't write file: %s", defaultsFileName)
+	} else {
+		logrus.Infof("Successfully added defaults of Helm builtin objects to: %s", defaultsFileName)
+	}
+}
+
+// Splits a line of defaults/main.yml into the key (or list item marker) and the scalar value.
+var defaultsValuePattern = regexp.MustCompile(`^(\s*(?:-\s+)?(?:[^:'"{#]+:\s+)?)(.*)$`)
+
+// Translates a YAML scalar holding Go template syntax to Jinja2, preserving its quoting style.
+func translateTemplateScalar(scalar string) (string, error) {
+	text, quote := scalar, byte(0)
+	if len(scalar) >= 2 && (scalar[0] == '"' || scalar[0] == '\'') && scalar[len(scalar)-1] == scalar[0] {
+		quote = scalar[0]
+	}
+	switch quote {
+	case '"':
+		unquoted, err := strconv.Unquote(scalar)
+		if err != nil {
+			return "", err
+		}
+		text = unquoted
+	case '\'':
+		text = strings.ReplaceAll(scalar[1:len(scalar)-1], "''", "'")
+	}
+	translated, err := j2parse.TranslateTemplateString(text)
+	if err != nil {
+		return "", err
+	}
+	translated = strings.ReplaceAll(translated, valuesString, "")
+	switch quote {
+	case '"':
+		return strconv.Quote(translated), nil
+	case '\'':
+		return "'" + strings.ReplaceAll(translated, "'", "''") + "'", nil
+	}
+	return translated, nil
+}
+
+// Converts the strings of defaults/main.yml which hold Go template syntax, to be rendered by "tpl", into Jinja2.
+// Ansible renders the templates within variables whenever they are referenced.  Strings which can't be converted are
+// left as they are, and are reported.
+func ConvertTemplateStringsInDefaults(roleDirectory string) {
+	defaultsFileName := getAnsibleRoleDefaultsFileName(roleDirectory)
+	j2parse.DefaultsFile = defaultsFileName
+	input, err := ioutil.ReadFile(defaultsFileName)
+	if err != nil {
+		logrus.Warnf("Skipping conversion of template strings, couldn't read file: %s", defaultsFileName)
+		return
+	}
+
+	lines := strings.Split(string(input), "\n")
+	for i, line := range lines {
+		if !strings.Contains(line, goTemplateLeftDelimiter) || strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		match := defaultsValuePattern.FindStringSubmatch(line)
+		translated, err := translateTemplateScalar(match[2])
+		if err != nil {
+			logrus.Warnf("Template string in %s line %d couldn't be converted to Jinja2, and requires a manual fix: "+
+				"%s", defaultsFileName, i, err)
+			continue
+		}
+		logrus.Infof("Template string in %s line %d converted to: %s", defaultsFileName, i, translated)
+		lines[i] = match[1] + translated
+	}
+	output := strings.Join(lines, "\n")
+	err = ioutil.WriteFile(defaultsFileName, []byte(output), defaultPermissions)
+	if err != nil {
+		logrus.Warnf("Skipping conversion of template strings, couldn't write file: %s", defaultsFileName)
+	} else {
+		logrus.Infof("Successfully converted template strings in: %s", defaultsFileName)
+	}
+}
+
 // Forms a hint comment that a manual fix is needed in defaults/main.yml due to a ".Values." self reference.
 func formManualFixIsRequiredHint(line string) string {
 	return helmDefaultsContainsSelfReference + "# " + line
@@ -266,48 +404,48 @@ func RemoveValuesReferencesInTemplates(roleDirectory string) {
 	}
 }
 
-// Removes Whitespace Trimming calls "{{-" and "-}}" and replaces them with "{{" and "}}" respectively in a given
-// template.  This is due to the fact that the Go text/template lexer is destructive, and ends up eating this
-// white-space.
-func suppressWhitespaceTrimmingInTemplate(templateFileName string) {
-	input, err := ioutil.ReadFile(templateFileName)
-	if err != nil {
-		logrus.Warnf("Skipping whitespace surpression, couldn't read file: %s", templateFileName)
-		return
+// Collects the template definitions ("define" and "block") parsed from a template file.  If a definition is found
+// more than once, the last one wins, which mirrors how Helm resolves duplicate definitions.
+func collectTemplateDefinitions(template *j2template.Template, definitions map[string]*j2parse.Tree) {
+	for _, definition := range template.Templates() {
+		if definition.Name() == template.Name() || definition.Tree == nil {
+			continue
+		}
+		if _, ok := definitions[definition.Name()]; ok {
+			logrus.Warnf("Template definition \"%s\" is defined more than once;  the last definition wins",
+				definition.Name())
+		}
+		definitions[definition.Name()] = definition.Tree
 	}
+}
 
-	lines := strings.Split(string(input), "\n")
-
-	lineNumbers := []int{}
-
-	for i, line := range lines {
-		if strings.Contains(line, "{{-") || strings.Contains(line, "-}}") {
-			logrus.Debugf("Suppressing whitespace in: %s on line %d", templateFileName, i)
-			lines[i] = strings.ReplaceAll(lines[i], "{{-", "{{")
-			lines[i] = strings.ReplaceAll(lines[i], "-}}", "}}")
-			lineNumbers = append(lineNumbers, i)
-		}
+// Writes the Jinja2 macro translation of all template definitions into the Ansible Role templates directory, and returns
+// the translation.
+func writeMacrosFile(templatesDirectory string, definitions map[string]*j2parse.Tree) string {
+	if len(definitions) == 0 {
+		return ""
 	}
-	output := strings.Join(lines, "\n")
-	err = ioutil.WriteFile(templateFileName, []byte(output), defaultPermissions)
+	macros := j2parse.Macros(definitions)
+	macrosFilePath := filepath.Join(templatesDirectory, j2parse.MacrosFileName)
+	err := ioutil.WriteFile(macrosFilePath, []byte(macros), defaultPermissions)
 	if err != nil {
-		logrus.Warnf("Skipping whitespace suppression couldn't write file: %s", templateFileName)
+		logrus.Warnf("Skipping translation of template definitions couldn't write file: %s", macrosFilePath)
 	} else {
-		logrus.Infof("Successfully suppressed whitespace in: %s on lines %d",
-			templateFileName, lineNumbers)
+		logrus.Infof("Successfully translated %d template definitions into: %s", len(definitions),
+			macrosFilePath)
 	}
+	return macros
 }
 
-// Removes Whitespace Trimming calls "{{-" and "-}}" and replaces them with "{{" and "}}" respectively for all templates
-// in an Ansible Role.  This is due to the fact that the Go text/template lexer is destructive, and ends up eating this
-// white-space.
-func SuppressWhitespaceTrimmingInTemplates(roleDirectory string) {
-	templatesDirectory := getAnsibleRoleTemplatesDirectory(roleDirectory)
-	logrus.Infof("templates dir: %s", templatesDirectory)
-	files, _ := readDir(templatesDirectory)
-	for _, file := range files {
-		templateFileName := filepath.Join(templatesDirectory, file.Name())
-		suppressWhitespaceTrimmingInTemplate(templateFileName)
+// Writes the template which renders the strings passed to "tpl" into the Ansible Role templates directory.
+func writeTemplateStringFile(templatesDirectory string) {
+	templateStringFilePath := filepath.Join(templatesDirectory, j2parse.TemplateStringFileName)
+	err := ioutil.WriteFile(templateStringFilePath, []byte(j2parse.TemplateStringTemplate), defaultPermissions)
+	if err != nil {
+		logrus.Warnf("Skipping the template rendering template strings, couldn't write file: %s",
+			templateStringFilePath)
+	} else {
+		logrus.Infof("Successfully installed the template rendering template strings: %s", templateStringFilePath)
 	}
 }
 
@@ -320,11 +458,23 @@ func SuppressWhitespaceTrimmingInTemplates(roleDirectory string) {
 //   {% if conditional %}
 //   ...
 //   {% endif %}
-func ConvertControlFlowSyntax(roleDirectory string) {
+// Template definitions found in any template, including Helm partials such as "_helpers.tpl", are translated into
+// Jinja2 macros and written to a single macros file.  Helm partials only contribute definitions, so they are removed
+// once their definitions have been collected.
+// Whitespace trim markers ("{{-" and "-}}") are carried over to the Jinja2 delimiters.  Ansible enables the Jinja2
+// "trim_blocks" option by default, which removes the first newline after every block and would render differently than
+// Helm, so each translated template starts with a header which disables it.  The values generated by Secret templates
+// are returned, so that the tasks can preserve them (see InstallAnsibleTasks).
+func ConvertControlFlowSyntax(roleDirectory string) []*j2parse.GeneratedValue {
 	defaultsFileName := getAnsibleRoleDefaultsFileName(roleDirectory)
 	j2parse.DefaultsFile = defaultsFileName
+	j2parse.ParseComments = true
+	logrus.Infof("Translating template functions using filter mappings version %d", j2parse.FilterMappingsVersion)
 	ansibleRoleTemplatesDirectory := getAnsibleRoleTemplatesDirectory(roleDirectory)
 	files, _ := readDir(ansibleRoleTemplatesDirectory)
+	definitions := map[string]*j2parse.Tree{}
+	var generatedValues []*j2parse.GeneratedValue
+	rendersTemplateStrings := false
 
 	for _, file := range files {
 		fileName := file.Name()
@@ -337,7 +487,18 @@ func ConvertControlFlowSyntax(roleDirectory string) {
 		if err != nil {
 			logrus.Fatalf("Couldn't instantiate the Go Template engine %s", err)
 		}
-		err = ioutil.WriteFile(templateFilePath, []byte(template.Tree.Root.String()), defaultPermissions)
+		collectTemplateDefinitions(template, definitions)
+		if isHelmPartialFile(fileName) {
+			err = os.Remove(templateFilePath)
+			if err != nil {
+				logrus.Warnf("Couldn't remove Helm partial after collecting its definitions: %s", templateFilePath)
+			}
+			continue
+		}
+		output := jinja2TrimBlocksOverride + template.Tree.Jinja2()
+		generatedValues = append(generatedValues, template.Tree.GeneratedValues()...)
+		rendersTemplateStrings = rendersTemplateStrings || strings.Contains(output, j2parse.TemplateStringFileName)
+		err = ioutil.WriteFile(templateFilePath, []byte(output), defaultPermissions)
 		if err != nil {
 			logrus.Warnf("Skipping translation of branch nodes couldn't write file: %s", templateFilePath)
 		} else {
@@ -345,17 +506,35 @@ func ConvertControlFlowSyntax(roleDirectory string) {
 				templateFilePath)
 		}
 	}
+	macros := writeMacrosFile(ansibleRoleTemplatesDirectory, definitions)
+	if rendersTemplateStrings || strings.Contains(macros, j2parse.TemplateStringFileName) {
+		writeTemplateStringFile(ansibleRoleTemplatesDirectory)
+	}
+	return generatedValues
+}
+
+// The data of the Ansible Playbook Role tasks/main.yml template.
+type ansibleTasks struct {
+	Templates    []string           // The translated templates, which are applied in order.
+	Secrets      []*generatedSecret // The Secret templates generating values, which are read before applying them.
+	Capabilities bool               // Whether the templates refer to the capabilities of the cluster, which are gathered.
 }
 
-// Installs the Ansible Playbook Role task responsible for invoking the translated templates.
-func InstallAnsibleTasks(roleDirectory string) {
+// Installs the Ansible Playbook Role task responsible for invoking the translated templates.  The values generated by
+// Secret templates are read from the existing Secrets beforehand, and only generated if not stored yet.  The
+// capabilities of the cluster are only gathered if the templates refer to them.
+func InstallAnsibleTasks(roleDirectory string, generatedValues []*j2parse.GeneratedValue) {
 	ansibleRoleTemplatesDirectory := getAnsibleRoleTemplatesDirectory(roleDirectory)
 	files, _ := readDir(ansibleRoleTemplatesDirectory)
 
-	// Generate a list of filenames to toss in the Ansible Playbook Role tasks/main.yml
+	// Generate a list of filenames to toss in the Ansible Playbook Role tasks/main.yml.  Partials, such as the macros
+	// file, are only imported by other templates and are not resources on their own.
 	var fileNames []string
 	for _, file := range files {
 		fileName := file.Name()
+		if isHelmPartialFile(fileName) {
+			continue
+		}
 		fileNames = append(fileNames, fileName)
 	}
 
@@ -370,7 +549,11 @@ func InstallAnsibleTasks(roleDirectory string) {
 	}
 
 	buf := &bytes.Buffer{}
-	err = template.Execute(buf, fileNames)
+	err = template.Execute(buf, ansibleTasks{
+		Templates:    fileNames,
+		Secrets:      getGeneratedSecrets(generatedValues),
+		Capabilities: j2parse.CapabilitiesUsed,
+	})
 	if err != nil {
 		logrus.Warnf("Couldn't generate the tasks main.yml file: %s", err)
 	}
@@ -0,0 +1,180 @@
+package convert
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
+	j2parse "github.com/redhat-nfvpe/helm-ansible-template-exporter/internal/pkg/text/template/parse"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+// Secret templates which generate passwords, keys or certificates are rendered on every run of the role, so the
+// generators are replaced by role variables (see j2parse.GeneratedValue).  Before the templates are applied, the tasks
+// read the Secret rendered by each such template, and set every variable to the value stored in the Secret, or to a new
+// value if the Secret doesn't exist yet or doesn't store it.  Random strings are generated with the "password" lookup,
+// and keys and certificates with the community.crypto modules.
+
+const existingSecretPrefix = "existing_"
+const nilOperand = "nil"
+
+// passwordCharacters maps the random string generators to the character sets of the Ansible "password" lookup.
+var passwordCharacters = map[string]string{
+	"randAlpha":    "ascii_letters",
+	"randAlphaNum": "ascii_letters,digits",
+	"randAscii":    "ascii_letters,digits,punctuation",
+	"randNumeric":  "digits",
+}
+
+// privateKeyTypes maps the key types of "genPrivateKey" to the type and curve of openssl_privatekey_pipe.
+var privateKeyTypes = map[string][2]string{
+	"dsa":     {"DSA", ""},
+	"ecdsa":   {"ECC", "secp256r1"},
+	"ed25519": {"Ed25519", ""},
+	"rsa":     {"RSA", ""},
+}
+
+// The generated values of a Secret template, rendered into tasks/main.yml.
+type generatedSecret struct {
+	Template     string            // The template rendering the Secret.
+	Register     string            // The variable registering the existing Secret.
+	Data         string            // The fact holding the data of the existing Secret.
+	Placeholders string            // The template variables standing in for the generated values, to render its name.
+	Values       []*generatedValue // The values generated by the template, in order.
+}
+
+// A generated value, rendered into tasks/main.yml.
+type generatedValue struct {
+	Variable    string // The role variable holding the value.
+	Stored      string // The condition under which the existing Secret stores the value, if it can be reused.
+	Absent      string // The condition under which the value is generated.
+	Reused      string // The expression of the stored value.
+	Password    string // The expression generating a random string.
+	KeyType     string // The type of the private key, for keys and certificates.
+	KeyCurve    string // The elliptic curve of the private key, if any.
+	Certificate *generatedCertificate
+}
+
+// The parameters of a generated certificate.
+type generatedCertificate struct {
+	CommonName     string
+	SubjectAltName string // The expression of the subject alternative names, if any.
+	Days           string
+	CA             bool
+	Issuer         string // The variable holding the signing CA, if not self-signed.
+}
+
+// Groups the generated values by Secret template, translating each into the parameters of its tasks.
+func getGeneratedSecrets(values []*j2parse.GeneratedValue) []*generatedSecret {
+	var secrets []*generatedSecret
+	bySecret := map[string]*generatedSecret{}
+	byVariable := map[string]*generatedValue{}
+	for _, value := range values {
+		secret, ok := bySecret[value.Template]
+		if !ok {
+			name := strings.TrimSuffix(value.Template, "."+j2Extension)
+			register := existingSecretPrefix + strings.Trim(paramconv.ToSnake(j2parse.MacroName(name)), "_")
+			secret = &generatedSecret{Template: value.Template, Register: register, Data: register + "_data"}
+			bySecret[value.Template] = secret
+			secrets = append(secrets, secret)
+		}
+		generated := getGeneratedValue(value, secret.Data, byVariable)
+		if generated.Stored != "" {
+			generated.Absent = "not (" + generated.Stored + ")"
+		} else {
+			logrus.Warnf("Value \"%s\" of template \"%s\" isn't stored by the Secret, so it is generated whenever "+
+				"the role runs", value.Variable, value.Template)
+		}
+		byVariable[value.Variable] = generated
+		secret.Values = append(secret.Values, generated)
+	}
+	for _, secret := range secrets {
+		var placeholders []string
+		for _, value := range secret.Values {
+			placeholder := "''"
+			if value.Certificate != nil {
+				placeholder = "{'Cert': '', 'Key': ''}"
+			}
+			placeholders = append(placeholders, "'"+value.Variable+"': "+placeholder)
+		}
+		secret.Placeholders = "{" + strings.Join(placeholders, ", ") + "}"
+	}
+	return secrets
+}
+
+// Translates a generated value into the parameters of its tasks.  Certificates are only reused along with their CA.
+func getGeneratedValue(value *j2parse.GeneratedValue, data string,
+	byVariable map[string]*generatedValue) *generatedValue {
+	operands := make([]string, len(value.Operands))
+	for i, operand := range value.Operands {
+		operands[i] = strings.ReplaceAll(operand, valuesString, "")
+	}
+	generated := &generatedValue{Variable: value.Variable}
+	if characters, ok := passwordCharacters[value.Function]; ok {
+		generated.Password = "lookup('password', '/dev/null length=' ~ " + operands[0] + " ~ ' chars=" + characters + "')"
+		generated.Stored, generated.Reused = storedValue(data, value.Keys[""])
+		return generated
+	}
+	if value.Function == "uuidv4" {
+		generated.Password = "lookup('password', '/dev/null length=32 chars=hexdigits') | to_uuid"
+		generated.Stored, generated.Reused = storedValue(data, value.Keys[""])
+		return generated
+	}
+	generated.KeyType, generated.KeyCurve = "RSA", ""
+	if value.Function == "genPrivateKey" {
+		keyType, err := strconv.Unquote(operands[0])
+		if parameters, ok := privateKeyTypes[keyType]; err == nil && ok {
+			generated.KeyType, generated.KeyCurve = parameters[0], parameters[1]
+		} else {
+			logrus.Warnf("Private key type %s of \"%s\" isn't known, so an RSA key is generated", operands[0],
+				value.Variable)
+		}
+		generated.Stored, generated.Reused = storedValue(data, value.Keys[""])
+		return generated
+	}
+	certificate := &generatedCertificate{CommonName: operands[0], Days: operands[len(operands)-1]}
+	switch value.Function {
+	case "genCA":
+		certificate.CA = true
+	case "genSelfSignedCert", "genSignedCert":
+		certificate.SubjectAltName = subjectAltName(operands[1], operands[2])
+		certificate.Days = operands[3]
+	}
+	generated.Certificate = certificate
+	stored, cert := storedValue(data, value.Keys["Cert"])
+	storedKey, key := storedValue(data, value.Keys["Key"])
+	if stored != "" && storedKey != "" {
+		generated.Stored = stored + " and " + storedKey
+		generated.Reused = "{'Cert': " + cert + ", 'Key': " + key + "}"
+	}
+	if value.Function == "genSignedCert" {
+		certificate.Issuer = operands[4]
+		issuer, ok := byVariable[certificate.Issuer]
+		if !ok || issuer.Stored == "" {
+			generated.Stored, generated.Reused = "", ""
+		} else if generated.Stored != "" {
+			generated.Stored += " and " + issuer.Stored
+		}
+	}
+	return generated
+}
+
+// Returns the condition under which the existing Secret stores a data key, and the expression of the stored value.
+func storedValue(data string, key string) (string, string) {
+	if key == "" {
+		return "", ""
+	}
+	quoted := "'" + strings.ReplaceAll(key, "'", "\\'") + "'"
+	return quoted + " in " + data, data + "[" + quoted + "] | b64decode"
+}
+
+// Returns the expression of the subject alternative names of a certificate, given the IP addresses and DNS names.
+func subjectAltName(ips string, dnsNames string) string {
+	var names []string
+	if ips != nilOperand {
+		names = append(names, "("+ips+" | map('regex_replace', '^', 'IP:') | list)")
+	}
+	if dnsNames != nilOperand {
+		names = append(names, "("+dnsNames+" | map('regex_replace', '^', 'DNS:') | list)")
+	}
+	return strings.Join(names, " + ")
+}
@@ -5,22 +5,11 @@ import (
 	"github.com/sirupsen/logrus"
 	"k8s.io/helm/pkg/chartutil"
 	"reflect"
-	"regexp"
 	"strings"
 )
 
 const goTemplateMemberAccessOperator = "."
 
-//LogHelmReport - Collect Log data and print
-type LogHelmReport struct {
-	Name         string
-	NewLine      string
-	OriginalLine string
-	FieldName    string
-	Action       string
-	LineNumber   int
-}
-
 // HelmChartRef is a global variable.  This is not ideal, but it is necessary in this case in order to avoid a circular
 // dependency issue.  Essentially, the cmd package is originally responsible for determining the HelmChartRef via
 // CLI interactions.  This package cannot depend on the "cmd" package, as it would cause a circular dependency.  The
@@ -102,145 +91,31 @@ func isBooleanYamlValue(input *map[string]interface{}, path *[]string, pathIndex
 }
 
 
-// GetValues takes a path that traverses a values that are stores in Values map and returns the value at the end of that path.
-// Given the following data the value at path "chapter.one.title" is "PR Review".
+// GetValueKind determines the kind of the value at a path of the chart's values, such as reflect.Map for a dictionary
+// or reflect.Slice for a list.  Given the following data the kind at path ".Values.ingress.hosts" is reflect.Slice.
 //
-//	chapter:
-//	  one:
-//	    title: "PR Review"
-func GetValues(arg string) (*map[string][]*LogHelmReport, error) {
-	argString := strings.ReplaceAll(arg, ".Values.", "")
+//	ingress:
+//	  hosts:
+//	    - name: chart-example.local
+func GetValueKind(arg string) (reflect.Kind, error) {
+	argString := strings.TrimPrefix(arg, ".Values.")
 	chartClient := NewChartClient()
 	err := chartClient.LoadChartFrom(HelmChartRef)
 	if err != nil {
 		logrus.Warnf("error loading chart: %s", err)
-		return nil, err
+		return reflect.Invalid, err
 	}
 	raw, _ := chartutil.ReadValues([]byte(chartClient.Chart.Values.Raw))
-	result, err := raw.PathValue(argString)
-	if err != nil {
-		logrus.Warnf("Path value not found for path : %s ", argString)
-		return nil, err
-	}
-	return dump(result), nil
-}
-
-// Converts and dumps the data of type interface{} slice
-// returned by chartUtil.GetPathValues into *map[string]interface{}
-func dump(result interface{}) *map[string][]*LogHelmReport {
-	items := reflect.ValueOf(result)
-	returnMap := make(map[string][]*LogHelmReport)
-	if items.Kind() == reflect.Slice {
-		for i := 0; i < items.Len(); i++ {
-			item := items.Index(i)
-			if item.Elem().Kind() == reflect.String {
-				returnMap[item.Interface().(string)] = []*LogHelmReport{}
-			} else if item.Elem().Kind() == reflect.Map {
-				returnMaps := item.Interface().(map[string]interface{})
-				for k := range returnMaps {
-					returnMap[k] = []*LogHelmReport{}
-				}
-			}
-		}
-	}
-	return &returnMap
-}
-
-// PreFixValuesWithItems...For single item list {% for item in hosts %}{{ item.name }}{% endfor %},
-// This function will prefix the list variables with a loop variable, within the body of the for loop.
-// There is two cases , one with field name that needs to be prefixed with loop variables
-// other condition is dot field name is replaced by loop variable
-func PreFixValuesWithItems(sb *strings.Builder, itemField string, pathValues *map[string][]*LogHelmReport) {
-	input := sb.String()
-	lines := strings.Split(string(input), "\n")
-	lineNumbers := []int{}
-	dotSuffixedField := " " + itemField + goTemplateMemberAccessOperator
-	sb.Reset()
-	for i, line := range lines {
-		for vars := range *pathValues {
-			if vars == goTemplateMemberAccessOperator { // if the replacing variable is dot then do this
-				re, err := regexp.Compile(`\s\.\s`)
-				if err == nil {
-					matched := re.MatchString(line)
-					if matched { //ignore line with template and includes
-						if strings.Contains(line, "template") || strings.Contains(line, "include") {
-							continue
-						}
-						lines[i] = re.ReplaceAllString(line, " "+itemField+" ")
-						logrus.Debugf("Replaced item %s  to : %s on line %d", vars, itemField, i)
-						r := new(LogHelmReport)
-						r.Action = vars + "Replaced with " + itemField + "\n"
-						r.NewLine = lines[i]
-						r.OriginalLine = line
-						r.FieldName = itemField
-						report := (*pathValues)[goTemplateMemberAccessOperator]
-						report = append(report, r)
-						(*pathValues)[goTemplateMemberAccessOperator] = report
-					}
-				}
-			} else {
-				re, err := regexp.Compile("\\s." + vars + "\\s")
-				if err == nil {
-					matched := re.MatchString(line)
-					if matched {
-						lines[i] = re.ReplaceAllString(line, dotSuffixedField+vars+" ")
-						logrus.Debugf("Appending item %s key to : %s on line %d", vars, dotSuffixedField+vars, i)
-						r := new(LogHelmReport)
-						r.Action = vars + " Replaced with " + itemField + "\n"
-						r.NewLine = lines[i]
-						r.OriginalLine = line
-						r.FieldName = itemField
-						report := (*pathValues)[goTemplateMemberAccessOperator]
-						report = append(report, r)
-						(*pathValues)[goTemplateMemberAccessOperator] = report
-					}
-				}
-			}
-			lineNumbers = append(lineNumbers, i)
-		}
+	// PathValue doesn't return tables (i.e., dictionaries), which are looked up separately.
+	if _, err := raw.Table(argString); err == nil {
+		return reflect.Map, nil
 	}
-	if len(lineNumbers) > 0 {
-		logrus.Infof("Successfully updated references for range item field: %s on lines %d",
-			itemField, lineNumbers)
-	}
-	output := strings.Join(lines, "\n")
-	sb.WriteString(output)
-
-}
-
-// Remove $ from loop variables and body of the loop
-func RemoveDollarPrefix(sb *strings.Builder) {
-	input := sb.String()
-	lines := strings.Split(string(input), "\n")
-	lineNumbers := []int{}
-	sb.Reset()
-	re, err := regexp.Compile(`\$\b`)
+	result, err := raw.PathValue(argString)
 	if err != nil {
-		sb.WriteString(input)
-		logrus.Errorf("Error parsing dollar sign %#v", err)
-		return
-	}
-	for i, line := range lines {
-		matched := re.MatchString(line)
-		if matched {
-			lines[i] = re.ReplaceAllString(line, "")
-			logrus.Debugf("Removed `$`  prefix form variable %s on line %d", line, i)
-			lineNumbers = append(lineNumbers, i)
-		}
+		return reflect.Invalid, err
 	}
-	if len(lineNumbers) > 0 {
-		logrus.Infof("Successfully cleaned `$` from range fields on lines %d", lineNumbers)
-	}
-	output := strings.Join(lines, "\n")
-	sb.WriteString(output)
-}
-
-// LogReports - Printing report struct
-func PrintReportItems(reports []*LogHelmReport) {
-	for i, r := range reports {
-		logrus.Info(i, ".Action: ", r.Action)
-		logrus.Info(".Field Name: ", r.FieldName)
-		logrus.Info(".Original Line: ", r.OriginalLine)
-		logrus.Info(".New Line: ", r.NewLine)
+	if result == nil {
+		return reflect.Invalid, errors.New("invalid path;  \"" + argString + "\" has no value in input YAML")
 	}
+	return reflect.TypeOf(result).Kind(), nil
 }
@@ -35,6 +35,7 @@ import (
 //
 //	- "include"
 //	- "tpl"
+//	- "lookup"
 //
 // These are late-bound in Engine.Render().  The
 // version included in the FuncMap is a placeholder.
@@ -56,10 +57,23 @@ func HelmFuncMap() FuncMap {
 
 		// This is a placeholder for the "include" function, which is
 		// late-bound to a template. By declaring it here, we preserve the
-		// integrity of the linter.
+		// integrity of the linter. The exporter translates "include" into a
+		// Jinja2 macro invocation, so this is never executed.
 		"include":  func(string, interface{}) string { return "not implemented" },
-		"tpl":      func(string, interface{}) interface{} { return "not implemented" },
 		"required": func(string, interface{}) (interface{}, error) { return "not implemented", nil },
+
+		// This is a placeholder for the "tpl" function, which renders a
+		// string as a template.  The exporter translates "tpl" into a
+		// lookup of a template rendering the string at runtime, so this is
+		// never executed.
+		"tpl": func(string, interface{}) interface{} { return "not implemented" },
+
+		// This is a placeholder for the "lookup" function, which queries
+		// the cluster.  The exporter translates "lookup" into the Ansible
+		// "kubernetes.core.k8s" lookup, so this is never executed.
+		"lookup": func(string, string, string, string) (map[string]interface{}, error) {
+			return map[string]interface{}{}, nil
+		},
 	}
 
 	for k, v := range extra {
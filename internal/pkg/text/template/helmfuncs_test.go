@@ -0,0 +1,26 @@
+package template
+
+import (
+	"github.com/redhat-nfvpe/helm-ansible-template-exporter/internal/pkg/text/template/parse"
+	"testing"
+)
+
+// Every function available to a Helm chart must declare its Ansible equivalent, even if it is unsupported.
+func TestFilterMappingsCoverHelmFunctions(t *testing.T) {
+	for _, funcs := range []FuncMap{builtins, HelmFuncMap()} {
+		for name := range funcs {
+			if _, ok := parse.FilterMappings[name]; !ok {
+				t.Errorf("Function %q has no filter mapping", name)
+			}
+		}
+	}
+}
+
+// Every rewritten function must register its writer, except those rewritten by the node writers themselves.
+func TestRewrittenFunctionsHaveWriters(t *testing.T) {
+	for name, mapping := range parse.FilterMappings {
+		if mapping.Support == parse.FilterRewritten && mapping.Translate == nil && name != "include" && name != "index" {
+			t.Errorf("Rewritten function %q has no writer", name)
+		}
+	}
+}
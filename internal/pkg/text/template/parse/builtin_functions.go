@@ -0,0 +1,89 @@
+package parse
+
+import "strings"
+
+// Several Go template builtins have Jinja2 counterparts which aren't filters.  These builtins are rewritten as the
+// equivalent Jinja2 expressions:
+//
+// slice x 1 3      ->  x[1:3]
+// print a b        ->  a ~ b
+// println a b      ->  a ~ ' ' ~ b ~ '\n'
+// js x             ->  (x | string | to_json)[1:-1]
+// not x            ->  not x
+//
+// The remaining builtins map onto filters (for example, "len" becomes "length" and "html" becomes "escape"), and are
+// declared in FilterMappings.  Go's "print" only inserts a space between operands when neither is a string, which
+// can't be determined statically, so operands are concatenated without separators.  JavaScript escaping is approximated
+// using JSON string escaping.
+
+// conditionFunctions are the builtins whose operands are evaluated for truthiness, including "and" and "or" (see
+// comparisons.go).  Within an "if" condition, their operands are written as conditions themselves;  see
+// writeValueNode.
+var conditionFunctions = map[string]bool{
+	"and": true,
+	"not": true,
+	"or":  true,
+}
+
+func translateSlice(operands []string) *string {
+	if len(operands) == 0 || len(operands) > 4 {
+		return nil
+	}
+	expression := parenthesize(operands[0])
+	switch len(operands) {
+	case 2:
+		expression += "[" + operands[1] + ":]"
+	case 3, 4:
+		// The third index of a full slice expression only limits the capacity of the result.
+		expression += "[" + operands[1] + ":" + operands[2] + "]"
+	}
+	return &expression
+}
+
+func translatePrint(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	if len(operands) == 1 {
+		expression := parenthesize(operands[0]) + " | string"
+		return &expression
+	}
+	return concatenate(operands, " ~ ")
+}
+
+func translatePrintln(operands []string) *string {
+	newline := `'\n'`
+	if len(operands) == 0 {
+		return &newline
+	}
+	expression := strings.Join(parenthesizeAll(operands), " ~ ' ' ~ ") + " ~ " + newline
+	return &expression
+}
+
+func translateJS(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	subject := parenthesize(operands[0])
+	if len(operands) > 1 {
+		subject = "(" + *concatenate(operands, " ~ ") + ")"
+	}
+	expression := "(" + subject + " | string | to_json)[1:-1]"
+	return &expression
+}
+
+func translateNot(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	// Although Jinja2 filters bind more tightly than "not", any operand which isn't a single term is parenthesized for
+	// clarity.
+	expression := "not " + parenthesizeTerm(operands[0])
+	return &expression
+}
+
+// Joins the operands using a Jinja2 operator, parenthesizing any operand which binds more loosely.
+func concatenate(operands []string, operator string) *string {
+	expression := strings.Join(parenthesizeAll(operands), operator)
+	return &expression
+}
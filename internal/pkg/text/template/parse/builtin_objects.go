@@ -0,0 +1,57 @@
+package parse
+
+import "strings"
+
+// Helm injects objects describing the release, the chart and the template being rendered into the root context of
+// every template.  Ansible has no such objects, so each of their fields is translated to a role variable, whose default
+// is written to defaults/main.yml by the exporter.  For example:
+//
+// app.kubernetes.io/instance: {{ .Release.Name }}
+// helm.sh/chart: {{ .Chart.Name }}-{{ .Chart.Version }}
+//
+// becomes:
+//
+// app.kubernetes.io/instance: {{ release_name }}
+// helm.sh/chart: {{ chart_name }}-{{ chart_version }}
+//
+// ".Template.Name" differs for each template, so it is derived from the "template_path" variable, which Ansible defines
+// while rendering a template.
+
+// BuiltinObjectVariables maps the fields of the Helm builtin objects to the role variables which replace them.
+var BuiltinObjectVariables = map[string]string{
+	"Chart.AppVersion":  "chart_app_version",
+	"Chart.Name":        "chart_name",
+	"Chart.Version":     "chart_version",
+	"Release.Name":      "release_name",
+	"Release.Namespace": "release_namespace",
+	"Release.Service":   "release_service",
+	"Template.BasePath": "template_base_path",
+}
+
+// builtinObjectExpressions maps the fields of the Helm builtin objects which are derived from other variables to their
+// Jinja2 expressions.
+var builtinObjectExpressions = map[string]string{
+	"Template.Name": "(template_base_path ~ '/' ~ (template_path | basename | splitext | first))",
+}
+
+// Returns the Jinja2 translation of a reference to a field of a Helm builtin object, such as ".Release.Name", and the
+// number of identifiers it consumes.  Zero is returned if the reference isn't to a translated field.
+func builtinObjectVariable(ident []string) (string, int) {
+	if !isHelmBuiltinObjectReference(ident) {
+		return "", 0
+	}
+	for n := len(ident); n >= 2; n-- {
+		field := strings.Join(ident[:n], ".")
+		if variable, ok := BuiltinObjectVariables[field]; ok {
+			return variable, n
+		}
+		if expression, ok := builtinObjectExpressions[field]; ok {
+			return expression, n
+		}
+		if variable, ok := capabilityVariables[field]; ok {
+			CapabilitiesUsed = true
+			return variable, n
+		}
+	}
+	return "", 0
+}
@@ -0,0 +1,126 @@
+package parse
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Charts adapt their manifests to the cluster using the ".Capabilities" object, most often to choose between API
+// versions:
+//
+// {{- if .Capabilities.APIVersions.Has "networking.k8s.io/v1" }}
+// apiVersion: networking.k8s.io/v1
+// {{- else if semverCompare ">=1.14-0" .Capabilities.KubeVersion.GitVersion }}
+// apiVersion: networking.k8s.io/v1beta1
+// {{- end }}
+//
+// The installed tasks gather the capabilities of the cluster once, using "kubernetes.core.k8s_cluster_info", into the
+// "api_versions" list, the "api_resources" dictionary (keyed by API version) and the "kube_version" string.  The
+// conditions become:
+//
+// {%- if 'networking.k8s.io/v1' in api_versions %}
+// apiVersion: networking.k8s.io/v1
+// {%- elif kube_version | regex_replace('^v|[-+].*$', '') is version('1.14', '>=') %}
+// apiVersion: networking.k8s.io/v1beta1
+// {%- endif %}
+//
+// Helm also accepts a resource, such as "networking.k8s.io/v1/Ingress", which is looked up in "api_resources".  Only
+// single semantic version constraints translate to the Ansible "version" test;  ranges and the "^" and "~" operators
+// are piped into the "semverCompare" filter plugin.  Pre-release and build suffixes are ignored, as in the "-0" idiom
+// above.
+
+// CapabilitiesUsed records whether any template written refers to the capabilities of the cluster.  Gathering them
+// queries the cluster, so the tasks only do so when it is set.
+var CapabilitiesUsed bool
+
+// capabilityVariables maps the fields of ".Capabilities" to the facts gathered by the installed tasks.
+var capabilityVariables = map[string]string{
+	"Capabilities.APIVersions":            "api_versions",
+	"Capabilities.KubeVersion":            "kube_version",
+	"Capabilities.KubeVersion.GitVersion": "kube_version",
+	"Capabilities.KubeVersion.Major":      "kube_version_major",
+	"Capabilities.KubeVersion.Minor":      "kube_version_minor",
+	"Capabilities.KubeVersion.Version":    "kube_version",
+}
+
+// capabilityMethods maps the methods of ".Capabilities" to the writers of their Jinja2 equivalents.  They are keyed by
+// field path, and thus aren't declared in FilterMappings.
+var capabilityMethods = map[string]func(operands []string) *string{
+	"Capabilities.APIVersions.Has": translateHasAPIVersion,
+}
+
+// semverOperators maps the operators of a semantic version constraint to the operators of the Ansible "version" test.
+var semverOperators = map[string]string{
+	"":   "==",
+	"=":  "==",
+	"!=": "!=",
+	">":  ">",
+	">=": ">=",
+	"<":  "<",
+	"<=": "<=",
+}
+
+// Returns the name of the ".Capabilities" method invoked by a node, such as "Capabilities.APIVersions.Has".
+func capabilityMethod(node Node) (string, bool) {
+	var ident []string
+	switch n := node.(type) {
+	case *FieldNode:
+		ident = n.Ident
+	case *VariableNode:
+		if len(n.Ident) == 0 || n.Ident[0] != goVariablePrefix {
+			return "", false
+		}
+		ident = n.Ident[1:]
+	default:
+		return "", false
+	}
+	name := strings.Join(ident, ".")
+	_, ok := capabilityMethods[name]
+	return name, ok
+}
+
+func translateHasAPIVersion(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	CapabilitiesUsed = true
+	version := operands[0]
+	if literal, err := strconv.Unquote(version); err == nil {
+		if i := strings.LastIndex(literal, "/"); i > 0 && isResourceKind(literal[i+1:]) {
+			expression := jinja2String(literal[i+1:]) + " in api_resources.get(" + jinja2String(literal[:i]) + ", {})"
+			return &expression
+		}
+		version = jinja2String(literal)
+	}
+	expression := parenthesize(version) + " in api_versions"
+	return &expression
+}
+
+// Kinds are capitalized, unlike the group and version of an API version.
+func isResourceKind(segment string) bool {
+	return segment != "" && strings.ToUpper(segment[:1]) == segment[:1] && strings.ToLower(segment[:1]) != segment[:1]
+}
+
+func translateSemverCompare(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	constraint, err := strconv.Unquote(operands[0])
+	if err != nil {
+		return shim("semverCompare").translate(operands)
+	}
+	constraint = strings.TrimSpace(constraint)
+	version := strings.TrimLeft(constraint, "=!<>")
+	operator := constraint[:len(constraint)-len(version)]
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	versionTest, ok := semverOperators[operator]
+	if !ok || version == "" || strings.ContainsAny(version, " ,|^~*xX") {
+		return shim("semverCompare").translate(operands)
+	}
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	expression := parenthesize(operands[1]) + " | regex_replace('^v|[-+].*$', '') is version(" + jinja2String(version) +
+		", " + jinja2String(versionTest) + ")"
+	return &expression
+}
@@ -0,0 +1,114 @@
+package parse
+
+import "strings"
+
+// Charts routinely build collections on the fly using Sprig, for example to pass several values to a template
+// definition:
+//
+// {{ include "nginx.tplValue" (dict "value" .Values.commonLabels "context" $) }}
+//
+// Jinja2 has literals for dictionaries and lists, and Ansible's "combine" filter merges dictionaries.  These functions
+// are rewritten as follows:
+//
+// dict k1 v1 k2 v2         ->  {k1: v1, k2: v2}
+// list a b                 ->  [a, b]
+// tuple a b                ->  [a, b]
+// merge dst src1 src2      ->  src2 | combine(src1, dst, recursive=True)
+// mergeOverwrite dst src   ->  dst | combine(src, recursive=True)
+// hasKey m k               ->  k in m
+// keys m                   ->  m.keys() | list
+// pluck k m1 m2            ->  [m1, m2] | selectattr(k, 'defined') | map(attribute=k) | list
+// until n                  ->  range(n) | list
+// untilStep a b s          ->  range(a, b, s) | list
+//
+// Sprig's "merge" gives precedence to the destination and then to each source in turn, whereas "combine" gives
+// precedence to its last argument, hence the reversed order.  Both merge nested dictionaries.  The integer sequences of
+// "until" and "untilStep" are most often ranged over, and become Jinja2 range() loops:
+//
+// {{- range $i := until 3 }}  ->  {%- for i in range(3) | list %}
+
+func translateDict(operands []string) *string {
+	var entries []string
+	for i := 0; i < len(operands); i += 2 {
+		// Sprig assigns an empty string to a trailing key without a value.
+		value := "''"
+		if i+1 < len(operands) {
+			value = operands[i+1]
+		}
+		entries = append(entries, operands[i]+": "+value)
+	}
+	expression := "{" + strings.Join(entries, ", ") + "}"
+	return &expression
+}
+
+func translateList(operands []string) *string {
+	expression := "[" + strings.Join(operands, ", ") + "]"
+	return &expression
+}
+
+func translateMerge(operands []string) *string {
+	if len(operands) < 2 {
+		return nil
+	}
+	reversed := make([]string, len(operands))
+	for i, operand := range operands {
+		reversed[len(operands)-1-i] = operand
+	}
+	return combine(reversed)
+}
+
+func translateMergeOverwrite(operands []string) *string {
+	if len(operands) < 2 {
+		return nil
+	}
+	return combine(operands)
+}
+
+// Combines dictionaries, giving precedence to the last.
+func combine(dictionaries []string) *string {
+	expression := parenthesize(dictionaries[0]) + " | combine(" + strings.Join(dictionaries[1:], ", ") +
+		", recursive=True)"
+	return &expression
+}
+
+func translateHasKey(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	expression := parenthesize(operands[1]) + " in " + parenthesize(operands[0])
+	return &expression
+}
+
+func translateKeys(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	keys := make([]string, len(operands))
+	for i, operand := range operands {
+		keys[i] = parenthesizeTerm(operand) + ".keys() | list"
+	}
+	if len(keys) == 1 {
+		return &keys[0]
+	}
+	expression := "(" + strings.Join(keys, ") + (") + ")"
+	return &expression
+}
+
+func translatePluck(operands []string) *string {
+	if len(operands) < 2 {
+		return nil
+	}
+	key := operands[0]
+	expression := "[" + strings.Join(operands[1:], ", ") + "] | selectattr(" + key + ", 'defined') | map(attribute=" +
+		key + ") | list"
+	return &expression
+}
+
+// Translates both "until" and "untilStep", whose operands are those of Jinja2's range().
+func translateUntil(operands []string) *string {
+	if len(operands) != 1 && len(operands) != 3 {
+		return nil
+	}
+	expression := "range(" + strings.Join(operands, ", ") + ") | list"
+	return &expression
+}
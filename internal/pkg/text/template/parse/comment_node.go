@@ -0,0 +1,66 @@
+package parse
+
+import "strings"
+
+// Go template comments ("{{/* ... */}}") are discarded by the upstream parser.  When ParseComments is set, the lexer
+// emits comments as actions, and the parser keeps them as CommentNodes so chart documentation survives the export.
+// Comments are written as Jinja2 comments, preserving any trim markers.  For example:
+//
+// {{- /* Expand the name of the chart. */ -}}
+//
+// becomes:
+//
+// {#- Expand the name of the chart. -#}
+//
+// A comment which immediately precedes a template definition documents the definition, and is also written ahead of
+// the translated macro.  This keeps the documentation found in Helm partials such as "_helpers.tpl", which are
+// otherwise only harvested for their definitions.
+
+// ParseComments controls whether comments are kept in the parse tree.  Template execution ignores CommentNodes.
+var ParseComments bool
+
+const commentLeftDelim = "{#"
+const commentRightDelim = "#}"
+
+// CommentNode holds a comment.
+type CommentNode struct {
+	NodeType
+	Pos
+	tr   *Tree
+	Text string      // Comment text, including the "/*" and "*/" markers.
+	Trim TrimMarkers // The trim markers of the action delimiters.
+}
+
+func (t *Tree) newComment(pos Pos, text string) *CommentNode {
+	return &CommentNode{tr: t, NodeType: NodeComment, Pos: pos, Text: text}
+}
+
+func (c *CommentNode) String() string {
+	var sb strings.Builder
+	c.writeTo(&sb)
+	return sb.String()
+}
+
+func (c *CommentNode) writeTo(sb *strings.Builder) {
+	c.Trim.writeLeftTo(sb, commentLeftDelim)
+	sb.WriteString(c.body())
+	c.Trim.writeRightTo(sb, commentRightDelim)
+}
+
+// Returns the comment text without the Go comment markers or surrounding white space.  Jinja2 ends a comment at the
+// first "#}", so any occurrence within the text is broken up.
+func (c *CommentNode) body() string {
+	body := strings.TrimSuffix(strings.TrimPrefix(c.Text, leftComment), rightComment)
+	body = strings.TrimSpace(body)
+	return strings.ReplaceAll(body, commentRightDelim, "# }")
+}
+
+func (c *CommentNode) tree() *Tree {
+	return c.tr
+}
+
+func (c *CommentNode) Copy() Node {
+	copied := c.tr.newComment(c.Pos, c.Text)
+	copied.Trim = c.Trim
+	return copied
+}
@@ -0,0 +1,75 @@
+package parse
+
+import "strings"
+
+// Go templates express boolean composition and comparison using prefix functions, whereas Jinja2 uses infix operators
+// (the "boolean composition problem").  For example:
+//
+// {{ if and .Values.enabled (eq .Values.service.type "NodePort" "LoadBalancer") }}
+//
+// becomes:
+//
+// {% if enabled and .Values.service.type in ["NodePort", "LoadBalancer"] %}
+//
+// "and" and "or" accept any number of operands, as does "eq", which compares its first operand to each of the others.
+// The comparison functions translate as follows:
+//
+// and a b c        ->  a and b and c
+// or a b c         ->  a or b or c
+// eq a b           ->  a == b
+// eq a b c         ->  a in [b, c]
+// ne a b           ->  a != b
+// lt a b           ->  a < b
+// le a b           ->  a <= b
+// gt a b           ->  a > b
+// ge a b           ->  a >= b
+//
+// Any operand which binds more loosely than the operator, such as a nested "or" within an "and", is parenthesized.
+// Within an "if" condition, the operands of "and" and "or" are written as conditions themselves.
+
+// Returns the writer of "and" or "or", which accept one or more operands.
+func logicalOperator(operator string) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) == 0 {
+			return nil
+		}
+		parenthesized := make([]string, len(operands))
+		for i, operand := range operands {
+			parenthesized[i] = parenthesizeOperand(operand, operator)
+		}
+		expression := strings.Join(parenthesized, " "+operator+" ")
+		return &expression
+	}
+}
+
+// Returns the writer of a binary comparison.
+func comparisonOperator(operator string) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) != 2 {
+			return nil
+		}
+		expression := parenthesize(operands[0]) + " " + operator + " " + parenthesize(operands[1])
+		return &expression
+	}
+}
+
+func translateEq(operands []string) *string {
+	if len(operands) < 2 {
+		return nil
+	}
+	if len(operands) == 2 {
+		return comparisonOperator("==")(operands)
+	}
+	expression := parenthesize(operands[0]) + " in [" + strings.Join(operands[1:], ", ") + "]"
+	return &expression
+}
+
+// Parenthesizes an operand of "and" or "or" unless it is a simple term, a comparison, or a chain of the same operator.
+func parenthesizeOperand(operand, operator string) string {
+	for _, token := range expressionTokens(operand) {
+		if (token == "and" || token == "or" || token == "if") && token != operator {
+			return "(" + operand + ")"
+		}
+	}
+	return operand
+}
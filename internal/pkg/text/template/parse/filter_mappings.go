@@ -0,0 +1,502 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+// Helm charts invoke the Go template builtins and the functions of Helm's function map (i.e., Sprig).  Ansible renders
+// templates using Jinja2, which offers a different set of filters, and the Sprig names mostly don't exist there.  Some
+// filters share the Sprig name but differ in behaviour;  Ansible's "quote" filter performs shell quoting, whereas
+// Sprig's "quote" produces a double quoted (and thus YAML safe) string.  FilterMappings declares, for every function
+// available to a Helm chart, how it translates to Ansible:
+//
+// native       The function is translated to an Ansible or Jinja2 filter (or test), remapping its arguments as needed.
+// shim         There is no equivalent, so the function is piped into a filter plugin of the same name, such as the
+//              stubs installed with the "generateFilters" option.
+// rewritten    The function is translated to a Jinja2 expression by dedicated code, either the writer registered with
+//              the mapping (such as those of the reordered and infix functions) or the node writers (such as the
+//              "index" subscripts).
+// unsupported  The function can't be expressed in Ansible.  The invocation is converted syntactically and flagged.
+//
+// Since Jinja2 filters receive the piped value as their first argument, each mapping names the Go argument to which
+// the filter applies (its subject), which is usually the last.  For example, the mapping of "trunc" translates:
+//
+// {{ trunc 63 .Values.name }}
+//
+// to:
+//
+// {{ .Values.name | truncate(63, True, '', 0) }}
+//
+// Any function which isn't found in the mappings is converted syntactically and flagged as well.
+
+// FilterMappingsVersion identifies the revision of FilterMappings, and is logged with each conversion.  It is
+// incremented whenever a mapping changes, so that a converted role can be traced back to the mappings which produced
+// it.  The mappings cover Sprig v3.2.2.
+const FilterMappingsVersion = 12
+
+// FilterSupport describes how well a function translates to Ansible.
+type FilterSupport int
+
+const (
+	FilterNative FilterSupport = iota
+	FilterShim
+	FilterRewritten
+	FilterUnsupported
+)
+
+func (s FilterSupport) String() string {
+	switch s {
+	case FilterNative:
+		return "native"
+	case FilterShim:
+		return "shim"
+	case FilterRewritten:
+		return "rewritten"
+	}
+	return "unsupported"
+}
+
+// FilterMapping describes the Ansible equivalent of a Go template function.
+type FilterMapping struct {
+	Filter  string        // The Jinja2 filter, chain of filters (such as "string | to_json") or test.
+	Subject int           // The Go argument the filter applies to, counting from 1.  Zero refers to the last argument.
+	Args    []string      // The filter arguments, where "$n" is the nth Go argument.  Nil passes the remaining arguments.
+	Arity   int           // The number of Go arguments, if greater than implied by Subject and Args.
+	Test    bool          // Whether Filter is a Jinja2 test, such as "search", rather than a filter.
+	Support FilterSupport // How well the function translates.
+
+	// Translate writes a rewritten function given its operands in Go argument order, returning nil when the operands
+	// don't match the function signature, in which case the invocation is converted syntactically.
+	Translate func(operands []string) *string
+}
+
+// Maps a function to a filter which takes the same arguments (beyond the subject) in the same order.
+func renamed(filter string) FilterMapping {
+	return FilterMapping{Filter: filter, Support: FilterNative}
+}
+
+// Maps a function to a filter which is applied to the last Go argument, with the given arguments.
+func native(filter string, args ...string) FilterMapping {
+	return FilterMapping{Filter: filter, Args: append([]string{}, args...), Support: FilterNative}
+}
+
+// Maps a function to a filter which is applied to the given Go argument, with the given arguments.
+func nativeOn(subject int, filter string, args ...string) FilterMapping {
+	mapping := native(filter, args...)
+	mapping.Subject = subject
+	return mapping
+}
+
+// Maps a function to a filter plugin of the same name.
+func shim(function string) FilterMapping {
+	return FilterMapping{Filter: function, Support: FilterShim}
+}
+
+// Maps a function to dedicated code which writes its Jinja2 equivalent.
+func rewrittenBy(translate func(operands []string) *string) FilterMapping {
+	return FilterMapping{Support: FilterRewritten, Translate: translate}
+}
+
+// Marks a function which is rewritten by the node writers themselves, such as the "index" subscripts.
+var rewritten = FilterMapping{Support: FilterRewritten}
+var unsupported = FilterMapping{Support: FilterUnsupported}
+
+// FilterMappings maps the Go template builtins and every function of the Helm function map to Ansible.
+var FilterMappings = map[string]FilterMapping{
+	// Go template builtins.
+	"and":      rewrittenBy(logicalOperator("and")),
+	"call":     unsupported,
+	"eq":       rewrittenBy(translateEq),
+	"ge":       rewrittenBy(comparisonOperator(">=")),
+	"gt":       rewrittenBy(comparisonOperator(">")),
+	"html":     native("escape"),
+	"index":    rewritten,
+	"js":       rewrittenBy(translateJS),
+	"le":       rewrittenBy(comparisonOperator("<=")),
+	"len":      native("length"),
+	"lt":       rewrittenBy(comparisonOperator("<")),
+	"ne":       rewrittenBy(comparisonOperator("!=")),
+	"not":      rewrittenBy(translateNot),
+	"or":       rewrittenBy(logicalOperator("or")),
+	"print":    rewrittenBy(translatePrint),
+	"printf":   rewrittenBy(translatePrintf),
+	"println":  rewrittenBy(translatePrintln),
+	"urlquery": native("urlencode"),
+
+	// Helm functions.
+	"fromJson":      renamed("from_json"),
+	"fromJsonArray": renamed("from_json"),
+	"fromYaml":      renamed("from_yaml"),
+	"fromYamlArray": renamed("from_yaml"),
+	"include":       rewritten,
+	"lookup":        rewrittenBy(translateLookup),
+	"required":      rewrittenBy(translateRequired),
+	"toJson":        rewrittenBy(translateToJSON),
+	"toToml":        shim("toToml"),
+	"toYaml":        rewrittenBy(translateToYAML),
+	"tpl":           rewritten, // Its writer is registered by template_strings.go.
+
+	// Sprig date functions.
+	"ago":              shim("ago"),
+	"date":             shim("date"),
+	"dateInZone":       shim("dateInZone"),
+	"dateModify":       shim("dateModify"),
+	"date_in_zone":     shim("date_in_zone"),
+	"date_modify":      shim("date_modify"),
+	"duration":         shim("duration"),
+	"durationRound":    shim("durationRound"),
+	"htmlDate":         shim("htmlDate"),
+	"htmlDateInZone":   shim("htmlDateInZone"),
+	"mustDateModify":   shim("mustDateModify"),
+	"must_date_modify": shim("must_date_modify"),
+	"mustToDate":       shim("mustToDate"),
+	"now":              shim("now"),
+	"toDate":           shim("toDate"),
+	"unixEpoch":        shim("unixEpoch"),
+
+	// Sprig string functions.
+	"abbrev":     native("truncate", "$1", "True", "'...'", "0"),
+	"abbrevboth": shim("abbrevboth"),
+	"camelcase":  shim("camelcase"),
+	"cat":        rewrittenBy(translateCat),
+	"contains":   rewrittenBy(infixOperator("in", false)),
+	"hasPrefix":  rewrittenBy(stringMethod("startswith")),
+	"hasSuffix":  rewrittenBy(stringMethod("endswith")),
+	"indent":     rewrittenBy(translateIndent),
+	"initials":   shim("initials"),
+	"kebabcase":  shim("kebabcase"),
+	"lower":      renamed("lower"),
+	"nindent":    rewrittenBy(translateNindent),
+	"nospace":    native("regex_replace", `'\\s'`, "''"),
+	"plural":     shim("plural"),
+	"quote":      native("string | to_json"),
+	"repeat":     shim("repeat"),
+	"replace":    native("replace", "$1", "$2"),
+	"shuffle":    shim("shuffle"),
+	"snakecase":  shim("snakecase"),
+	"squote":     shim("squote"),
+	"substr":     shim("substr"),
+	"swapcase":   shim("swapcase"),
+	"title":      renamed("title"),
+	"trim":       renamed("trim"),
+	"trimAll":    rewrittenBy(translateTrimAll),
+	"trimPrefix": native("regex_replace", "'^' ~ ($1 | regex_escape)", "''"),
+	"trimSuffix": native("regex_replace", "($1 | regex_escape) ~ '$'", "''"),
+	"trimall":    rewrittenBy(translateTrimAll),
+	"trunc":      native("truncate", "$1", "True", "''", "0"),
+	"untitle":    shim("untitle"),
+	"upper":      renamed("upper"),
+	"wrap":       native("wordwrap", "$1"),
+	"wrapWith":   native("wordwrap", "$1", "True", "$2"),
+
+	// Sprig random string functions.
+	"randAlpha":    shim("randAlpha"),
+	"randAlphaNum": shim("randAlphaNum"),
+	"randAscii":    shim("randAscii"),
+	"randNumeric":  shim("randNumeric"),
+
+	// Sprig string list functions.
+	"join":      native("join", "$1"),
+	"sortAlpha": native("map('string') | sort"),
+	"split":     shim("split"),
+	"splitList": native("split", "$1"),
+	"splitn":    shim("splitn"),
+	"toStrings": native("map('string') | list"),
+
+	// Sprig type conversion functions.
+	"atoi":      native("int"),
+	"float64":   native("float"),
+	"int":       native("int"),
+	"int64":     native("int"),
+	"toDecimal": shim("toDecimal"),
+	"toString":  native("string"),
+
+	// Sprig math functions.
+	"add":       rewrittenBy(infixOperator("+", true)),
+	"add1":      rewrittenBy(translateIncrement),
+	"add1f":     rewrittenBy(translateIncrement),
+	"addf":      rewrittenBy(infixOperator("+", true)),
+	"biggest":   shim("biggest"),
+	"ceil":      native("round", "0", "'ceil'"),
+	"div":       rewrittenBy(infixOperator("//", false)),
+	"divf":      rewrittenBy(infixOperator("/", true)),
+	"floor":     native("round", "0", "'floor'"),
+	"max":       shim("max"),
+	"maxf":      shim("maxf"),
+	"min":       shim("min"),
+	"minf":      shim("minf"),
+	"mod":       rewrittenBy(infixOperator("%", false)),
+	"mul":       rewrittenBy(infixOperator("*", true)),
+	"mulf":      rewrittenBy(infixOperator("*", true)),
+	"randInt":   shim("randInt"),
+	"round":     nativeOn(1, "round", "$2"),
+	"seq":       shim("seq"),
+	"sub":       rewrittenBy(infixOperator("-", false)),
+	"subf":      rewrittenBy(infixOperator("-", true)),
+	"until":     rewrittenBy(translateUntil),
+	"untilStep": rewrittenBy(translateUntil),
+
+	// Sprig default and flow control functions.
+	"all":      shim("all"),
+	"any":      shim("any"),
+	"coalesce": rewrittenBy(translateCoalesce),
+	"default":  rewrittenBy(translateDefault),
+	"empty":    rewrittenBy(translateEmpty),
+	"fail":     unsupported,
+	"ternary":  rewrittenBy(translateTernary),
+
+	// Sprig encoding and JSON functions.
+	"b32dec":           shim("b32dec"),
+	"b32enc":           shim("b32enc"),
+	"b64dec":           native("b64decode"),
+	"b64enc":           native("b64encode"),
+	"mustFromJson":     renamed("from_json"),
+	"mustToJson":       rewrittenBy(translateToJSON),
+	"mustToPrettyJson": native("to_nice_json", "indent=2"),
+	"mustToRawJson":    native("to_json"),
+	"toPrettyJson":     native("to_nice_json", "indent=2"),
+	"toRawJson":        native("to_json"),
+
+	// Sprig reflection functions.
+	"deepCopy":     shim("deepCopy"),
+	"deepEqual":    rewrittenBy(infixOperator("==", false)),
+	"kindIs":       rewrittenBy(typeTest("kindIs", kindTests)),
+	"kindOf":       shim("kindOf"),
+	"mustDeepCopy": shim("mustDeepCopy"),
+	"typeIs":       rewrittenBy(typeTest("typeIs", typeTests)),
+	"typeIsLike":   shim("typeIsLike"),
+	"typeOf":       shim("typeOf"),
+
+	// Sprig path and network functions.
+	"base":          native("basename"),
+	"clean":         shim("clean"),
+	"dir":           native("dirname"),
+	"ext":           native("splitext | last"),
+	"getHostByName": unsupported,
+	"isAbs":         shim("isAbs"),
+	"osBase":        native("basename"),
+	"osClean":       shim("osClean"),
+	"osDir":         native("dirname"),
+	"osExt":         native("splitext | last"),
+	"osIsAbs":       shim("osIsAbs"),
+	"urlJoin":       shim("urlJoin"),
+	"urlParse":      shim("urlParse"),
+
+	// Sprig dictionary functions.
+	"dict":               rewrittenBy(translateDict),
+	"dig":                shim("dig"),
+	"get":                shim("get"),
+	"hasKey":             rewrittenBy(translateHasKey),
+	"keys":               rewrittenBy(translateKeys),
+	"merge":              rewrittenBy(translateMerge),
+	"mergeOverwrite":     rewrittenBy(translateMergeOverwrite),
+	"mustMerge":          rewrittenBy(translateMerge),
+	"mustMergeOverwrite": rewrittenBy(translateMergeOverwrite),
+	"omit":               shim("omit"),
+	"pick":               shim("pick"),
+	"pluck":              rewrittenBy(translatePluck),
+	"set":                shim("set"),
+	"unset":              shim("unset"),
+	"values":             native("dict2items | map(attribute='value') | list"),
+
+	// Sprig list functions.
+	"append":      shim("append"),
+	"chunk":       shim("chunk"),
+	"compact":     native("select | list"),
+	"concat":      rewrittenBy(infixOperator("+", true)),
+	"first":       native("first"),
+	"has":         rewrittenBy(infixOperator("in", false)),
+	"initial":     shim("initial"),
+	"last":        native("last"),
+	"list":        rewrittenBy(translateList),
+	"mustAppend":  shim("mustAppend"),
+	"mustChunk":   shim("mustChunk"),
+	"mustCompact": native("select | list"),
+	"mustFirst":   native("first"),
+	"mustHas":     rewrittenBy(infixOperator("in", false)),
+	"mustInitial": shim("mustInitial"),
+	"mustLast":    native("last"),
+	"mustPrepend": shim("mustPrepend"),
+	"mustPush":    shim("mustPush"),
+	"mustRest":    shim("mustRest"),
+	"mustReverse": native("reverse | list"),
+	"mustSlice":   rewrittenBy(translateSlice),
+	"mustUniq":    native("unique"),
+	"mustWithout": shim("mustWithout"),
+	"prepend":     shim("prepend"),
+	"push":        shim("push"),
+	"rest":        shim("rest"),
+	"reverse":     native("reverse | list"),
+	"slice":       rewrittenBy(translateSlice),
+	"tuple":       rewrittenBy(translateList),
+	"uniq":        native("unique"),
+	"without":     shim("without"),
+
+	// Sprig cryptographic and security functions.
+	"adler32sum":               shim("adler32sum"),
+	"bcrypt":                   shim("bcrypt"),
+	"buildCustomCert":          shim("buildCustomCert"),
+	"decryptAES":               shim("decryptAES"),
+	"derivePassword":           shim("derivePassword"),
+	"encryptAES":               shim("encryptAES"),
+	"genCA":                    shim("genCA"),
+	"genCAWithKey":             shim("genCAWithKey"),
+	"genPrivateKey":            shim("genPrivateKey"),
+	"genSelfSignedCert":        shim("genSelfSignedCert"),
+	"genSelfSignedCertWithKey": shim("genSelfSignedCertWithKey"),
+	"genSignedCert":            shim("genSignedCert"),
+	"genSignedCertWithKey":     shim("genSignedCertWithKey"),
+	"htpasswd":                 shim("htpasswd"),
+	"randBytes":                shim("randBytes"),
+	"sha1sum":                  native("hash", "'sha1'"),
+	"sha256sum":                native("hash", "'sha256'"),
+	"uuidv4":                   shim("uuidv4"),
+
+	// Sprig semantic version functions.
+	"semver":        shim("semver"),
+	"semverCompare": rewrittenBy(translateSemverCompare),
+
+	// Sprig regular expression functions.
+	"mustRegexFind":              nativeOn(2, "regex_search", "$1"),
+	"mustRegexFindAll":           FilterMapping{Filter: "regex_findall", Subject: 2, Args: []string{"$1"}, Arity: 3},
+	"mustRegexMatch":             FilterMapping{Filter: "search", Args: []string{"$1"}, Test: true},
+	"mustRegexReplaceAll":        rewrittenBy(regexReplacement("mustRegexReplaceAll", expandedReplacement)),
+	"mustRegexReplaceAllLiteral": rewrittenBy(regexReplacement("mustRegexReplaceAllLiteral", literalReplacement)),
+	"mustRegexSplit":             shim("mustRegexSplit"),
+	"regexFind":                  nativeOn(2, "regex_search", "$1"),
+	"regexFindAll":               FilterMapping{Filter: "regex_findall", Subject: 2, Args: []string{"$1"}, Arity: 3},
+	"regexMatch":                 FilterMapping{Filter: "search", Args: []string{"$1"}, Test: true},
+	"regexQuoteMeta":             native("regex_escape"),
+	"regexReplaceAll":            rewrittenBy(regexReplacement("regexReplaceAll", expandedReplacement)),
+	"regexReplaceAllLiteral":     rewrittenBy(regexReplacement("regexReplaceAllLiteral", literalReplacement)),
+	"regexSplit":                 shim("regexSplit"),
+
+	// Sprig miscellaneous functions.
+	"hello": shim("hello"),
+}
+
+// Returns the number of Go arguments the mapping expects, or zero if any number of arguments beyond the subject is
+// accepted.
+func (m FilterMapping) arity() int {
+	if m.Args == nil {
+		return 0
+	}
+	arity := m.Arity
+	if m.Subject > arity {
+		arity = m.Subject
+	}
+	for _, arg := range m.Args {
+		for _, n := range argumentReferences(arg) {
+			if n > arity {
+				arity = n
+			}
+		}
+	}
+	if m.Subject == 0 {
+		arity++
+	}
+	return arity
+}
+
+// Translates an invocation to the mapped filter, given the operands in Go argument order.  Returns nil if the operands
+// don't match the mapping.
+func (m FilterMapping) translate(operands []string) *string {
+	if len(operands) == 0 || (m.arity() > 0 && len(operands) != m.arity()) || len(operands) < m.Subject {
+		return nil
+	}
+	subject := len(operands) - 1
+	if m.Subject > 0 {
+		subject = m.Subject - 1
+	}
+	var args []string
+	if m.Args == nil {
+		args = append(append(args, operands[:subject]...), operands[subject+1:]...)
+	} else {
+		for _, arg := range m.Args {
+			args = append(args, expandArgumentReferences(arg, operands))
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString(parenthesize(operands[subject]))
+	if m.Test {
+		sb.WriteString(" is ")
+	} else {
+		sb.WriteString(" | ")
+	}
+	sb.WriteString(m.Filter)
+	if len(args) > 0 {
+		sb.WriteByte('(')
+		sb.WriteString(strings.Join(args, ", "))
+		sb.WriteByte(')')
+	}
+	expression := sb.String()
+	return &expression
+}
+
+// Returns the Go arguments referenced ("$n") by a mapping argument.
+func argumentReferences(arg string) []int {
+	var references []int
+	for i := 0; i < len(arg); i++ {
+		if n, width := argumentReference(arg[i:]); width > 0 {
+			references = append(references, n)
+			i += width - 1
+		}
+	}
+	return references
+}
+
+// Replaces the references ("$n") of a mapping argument with the corresponding operands.
+func expandArgumentReferences(arg string, operands []string) string {
+	var sb strings.Builder
+	for i := 0; i < len(arg); i++ {
+		if n, width := argumentReference(arg[i:]); width > 0 {
+			sb.WriteString(operands[n-1])
+			i += width - 1
+			continue
+		}
+		sb.WriteByte(arg[i])
+	}
+	return sb.String()
+}
+
+// Parses a reference ("$n") at the start of s, returning the argument number and the width of the reference.
+func argumentReference(s string) (int, int) {
+	if !strings.HasPrefix(s, "$") {
+		return 0, 0
+	}
+	width := 1
+	for width < len(s) && s[width] >= '0' && s[width] <= '9' {
+		width++
+	}
+	n, err := strconv.Atoi(s[1:width])
+	if err != nil || n == 0 {
+		return 0, 0
+	}
+	return n, width
+}
+
+// Determines the translation of a function from its mapping, flagging any function which can't be translated.
+func mappedFunction(name string) func(operands []string) *string {
+	mapping, ok := FilterMappings[name]
+	if !ok {
+		logrus.Warnf("Function \"%s\" is not in the filter mappings (version %d) and was converted syntactically",
+			name, FilterMappingsVersion)
+		return nil
+	}
+	if mapping.Support == FilterUnsupported {
+		logrus.Warnf("Function \"%s\" is unsupported by the filter mappings (version %d) and was converted syntactically",
+			name, FilterMappingsVersion)
+		return nil
+	}
+	if mapping.Support == FilterRewritten {
+		return mapping.Translate
+	}
+	if mapping.Support == FilterShim {
+		logrus.Warnf("Function \"%s\" has no Ansible equivalent in the filter mappings (version %d) and was piped "+
+			"into the \"%s\" filter plugin, which must be implemented;  the plugins installed by the generateFilters "+
+			"option are stubs", name, FilterMappingsVersion, mapping.Filter)
+	}
+	return mapping.translate
+}
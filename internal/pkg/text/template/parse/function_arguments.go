@@ -0,0 +1,252 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// Go template functions receive a piped value as their last argument, whereas Jinja2 filters receive it as their first.
+// Most functions translate naturally since the value being operated on is also the last argument in Sprig, but a few
+// common functions take their arguments in an order which can't be piped as is.  For example, "default" takes the
+// default value first:
+//
+// {{ default "nginx" .Values.name }}
+//
+// A purely syntactic translation yields "nginx" | default(.Values.name), which is backwards.  Instead, these functions
+// are rewritten from a table keyed by function name.  Each entry receives the operands in Go argument order, with the
+// piped value (if any) appended, and returns the equivalent Jinja2 expression:
+//
+// default d v      ->  v | default(d, true)
+// required msg v   ->  v if (v is defined and v != '') else undef(hint=msg)
+// ternary a b c    ->  a if c else b
+// coalesce a b c   ->  a | default(b, true) | default(c, true)
+// empty v          ->  v is not defined or not v
+//
+// Go treats a zero value (i.e., "", 0, false or an empty collection) as empty, which corresponds to the second "true"
+// argument of the Jinja2 "default" filter and to Jinja2 truthiness.  Sprig also treats a missing value as empty, and
+// "required" rejects an empty string as well as a missing value, whereas an undefined variable raises an error under
+// Ansible's strict undefined handling;  hence the definition tests.
+
+func translateDefault(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	expression := parenthesize(operands[1]) + " | default(" + operands[0] + ", true)"
+	return &expression
+}
+
+func translateRequired(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	value := parenthesize(operands[1])
+	expression := value + " if (" + value + " is defined and " + value + " != '') else undef(hint=" + operands[0] + ")"
+	return &expression
+}
+
+func translateTernary(operands []string) *string {
+	if len(operands) != 3 {
+		return nil
+	}
+	expression := parenthesize(operands[0]) + " if " + parenthesize(operands[2]) + " else " + parenthesize(operands[1])
+	return &expression
+}
+
+func translateCoalesce(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	expression := parenthesize(operands[0])
+	for _, operand := range operands[1:] {
+		expression += " | default(" + operand + ", true)"
+	}
+	return &expression
+}
+
+func translateEmpty(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	value := parenthesize(operands[0])
+	expression := value + " is not defined or not " + value
+	return &expression
+}
+
+// Returns the arguments of a command, which is either a CommandNode or an IfCommandNode.
+func commandArgs(command Node) []Node {
+	switch c := command.(type) {
+	case *CommandNode:
+		return c.Args
+	case *IfCommandNode:
+		return c.Args
+	}
+	return nil
+}
+
+// Determines the function invoked by a command, and its translation from the capability methods or the filter mappings.
+func translatedFunction(args []Node) (string, func(operands []string) *string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	if name, ok := capabilityMethod(args[0]); ok {
+		return name, capabilityMethods[name]
+	}
+	identifier, ok := args[0].(*IdentifierNode)
+	if !ok {
+		return "", nil
+	}
+	return identifier.Ident, mappedFunction(identifier.Ident)
+}
+
+// Writes the arguments of a function invocation as Jinja2 operands.  Within an "if" condition, the operands of the
+// condition functions are written as conditions.
+func functionOperands(command Node, name string, args []Node) []string {
+	_, isCondition := command.(*IfCommandNode)
+	operands := make([]string, 0, len(args))
+	for _, arg := range args {
+		var sb strings.Builder
+		if isCondition && conditionFunctions[name] {
+			writeConditionArgTo(&sb, arg)
+		} else {
+			arg.writeTo(&sb)
+		}
+		operands = append(operands, sb.String())
+	}
+	return operands
+}
+
+// Writes the commands of a pipeline.  Commands are normally joined by Jinja2 pipes, but a command invoking a translated
+// function consumes the expression written so far as its last operand.  Within an "if", the commands of a pipeline
+// such as "a | default b" are written as values, and only the result of the pipeline is tested for truthiness.
+func writePipelineTo(sb *strings.Builder, commands []Node) {
+	var expression string
+	for i, command := range commands {
+		if len(commands) > 1 {
+			command = valueCommand(command)
+		}
+		if c, ok := command.(*CommandNode); ok {
+			c.PipeNodeCount = i
+		}
+		args := commandArgs(command)
+		if len(args) > 0 {
+			var piped []string
+			if i > 0 {
+				piped = []string{expression}
+			}
+			if value := generatedValue(command, args, piped); value != nil {
+				expression = value.Variable
+				continue
+			}
+		}
+		if name, translate := translatedFunction(args); translate != nil {
+			operands := functionOperands(command, name, args[1:])
+			if i > 0 {
+				operands = append(operands, expression)
+			}
+			if translated := translate(operands); translated != nil {
+				logrus.Infof("Function \"%s\" converted to: %s", name, *translated)
+				expression = *translated
+				continue
+			}
+			logrus.Warnf("Function \"%s\" was converted syntactically, since its arguments are unexpected: %s", name,
+				operands)
+		}
+		var b strings.Builder
+		command.writeTo(&b)
+		if i > 0 {
+			expression = parenthesize(expression) + " | " + b.String()
+		} else {
+			expression = b.String()
+		}
+	}
+	sb.WriteString(expression)
+}
+
+// Wraps an expression in parentheses, unless it already binds at least as tightly as a Jinja2 filter.
+func parenthesize(expression string) string {
+	if isComposite(expression) {
+		return "(" + expression + ")"
+	}
+	return expression
+}
+
+// Wraps an expression in parentheses, unless it is a single term.  Terms may be followed by an attribute or subscript.
+func parenthesizeTerm(expression string) string {
+	if len(expressionTokens(expression)) > 1 {
+		return "(" + expression + ")"
+	}
+	return expression
+}
+
+// Parenthesizes each of the operands as needed.
+func parenthesizeAll(operands []string) []string {
+	parenthesized := make([]string, len(operands))
+	for i, operand := range operands {
+		parenthesized[i] = parenthesize(operand)
+	}
+	return parenthesized
+}
+
+// Determines whether an expression binds more loosely than a Jinja2 filter, such as "a and b" or "a if c else b".  An
+// expression consisting of an operand followed by a chain of filters (i.e., "a | default(b)") is not composite.
+func isComposite(expression string) bool {
+	tokens := expressionTokens(expression)
+	for i := 1; i < len(tokens); i += 2 {
+		if tokens[i] != "|" {
+			return true
+		}
+	}
+	return false
+}
+
+// Splits an expression into its tokens.  Only white space outside of string literals, parentheses and brackets
+// separates tokens.
+func expressionTokens(expression string) []string {
+	var tokens []string
+	var token strings.Builder
+	depth := 0
+	var quote rune
+	for _, r := range expression {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		case r == ' ' && depth == 0:
+			if token.Len() > 0 {
+				tokens = append(tokens, token.String())
+				token.Reset()
+			}
+			continue
+		}
+		token.WriteRune(r)
+	}
+	if token.Len() > 0 {
+		tokens = append(tokens, token.String())
+	}
+	return tokens
+}
+
+// Returns the commands of a pipeline as Nodes.
+func commandNodes(cmds []*CommandNode) []Node {
+	nodes := make([]Node, len(cmds))
+	for i, c := range cmds {
+		nodes[i] = c
+	}
+	return nodes
+}
+
+// Returns the commands of an "if" pipeline as Nodes.
+func ifCommandNodes(cmds []*IfCommandNode) []Node {
+	nodes := make([]Node, len(cmds))
+	for i, c := range cmds {
+		nodes[i] = c
+	}
+	return nodes
+}
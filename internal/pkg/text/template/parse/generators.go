@@ -0,0 +1,197 @@
+package parse
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
+	"github.com/sirupsen/logrus"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Charts commonly generate passwords, keys and certificates while rendering their Secrets:
+//
+// data:
+//   password: {{ randAlphaNum 16 | b64enc }}
+//   {{- $ca := genCA "my-ca" 365 }}
+//   ca.crt: {{ $ca.Cert | b64enc }}
+//
+// Helm renders the templates once per install or upgrade, whereas an operator renders them on every reconciliation,
+// which would replace the Secret with new values each time.  Within a Secret template, each invocation of a generator is
+// therefore replaced by a role variable:
+//
+// data:
+//   password: {{ generated_secret_password | b64encode }}
+//   {%- set var_ca = generated_secret_ca %}
+//   ca.crt: {{ var_ca.Cert | b64encode }}
+//
+// The values are recorded on the tree (see GeneratedValues), along with the data keys of the Secret which store them.
+// The exporter installs tasks which read the existing Secret, reuse the stored values if present, and otherwise
+// generate new ones using Ansible's "password" lookup or the community.crypto modules.  Generators invoked outside of a
+// Secret template are piped into their filter plugins, and produce a new value on every rendering.
+
+// generatorFunctions maps the random and crypto functions whose values are preserved to the number of their arguments.
+var generatorFunctions = map[string]int{
+	"genCA":             2,
+	"genPrivateKey":     1,
+	"genSelfSignedCert": 4,
+	"genSignedCert":     5,
+	"randAlpha":         1,
+	"randAlphaNum":      1,
+	"randAscii":         1,
+	"randNumeric":       1,
+	"uuidv4":            0,
+}
+
+// generatedVariablePrefix prefixes the role variables holding generated values.
+const generatedVariablePrefix = "generated_"
+
+// GeneratedValue describes a value generated by a random or crypto function in a Secret template.
+type GeneratedValue struct {
+	Template string            // The name of the template, such as "secret.yaml.j2".
+	Variable string            // The role variable replacing the invocation, such as "generated_secret_password".
+	Function string            // The generator, such as "randAlphaNum".
+	Operands []string          // The Jinja2 operands of the generator, in Go argument order.
+	Keys     map[string]string // The data keys storing the value, keyed by field ("Cert" or "Key") for crypto objects.
+}
+
+var secretKindPattern = regexp.MustCompile(`(?m)^kind:\s*["']?Secret["']?\s*$`)
+
+// Matches a YAML key ending the text which precedes an action, such as "  password: ".
+var dataKeyPattern = regexp.MustCompile(`(?:^|\n)[ \t]*["']?([\w.-]+)["']?:[ \t]*$`)
+
+// GeneratedValues returns the values generated by the tree, once its translation has been written.
+func (t *Tree) GeneratedValues() []*GeneratedValue {
+	return t.generatedValues
+}
+
+// Determines whether the tree is a template of a Secret manifest.
+func (t *Tree) isSecretTemplate() bool {
+	return t != nil && secretKindPattern.MatchString(t.text)
+}
+
+// Records the YAML key ending the text preceding the next action.
+func (t *Tree) recordSecretDataKey(text string) {
+	if t == nil {
+		return
+	}
+	if match := dataKeyPattern.FindStringSubmatch(text); match != nil {
+		t.secretDataKey = match[1]
+	} else if text != "" {
+		t.secretDataKey = ""
+	}
+}
+
+// Returns the generated value replacing a command, or nil if the command doesn't invoke a generator within a Secret
+// template.  The value is recorded the first time the command is written.
+func generatedValue(command Node, args []Node, piped []string) *GeneratedValue {
+	identifier, ok := args[0].(*IdentifierNode)
+	if !ok {
+		return nil
+	}
+	arity, ok := generatorFunctions[identifier.Ident]
+	if !ok {
+		return nil
+	}
+	tr := command.tree()
+	if !tr.isSecretTemplate() || inMacro() {
+		logrus.Warnf("Function \"%s\" generates a new value whenever the template is rendered;  only the values "+
+			"generated by Secret templates are preserved", identifier.Ident)
+		return nil
+	}
+	if value, ok := tr.generatedCommands[command]; ok {
+		return value
+	}
+	operands := append(functionOperands(command, identifier.Ident, args[1:]), piped...)
+	if len(operands) != arity {
+		logrus.Warnf("Function \"%s\" generates a new value whenever the template is rendered, since its arguments "+
+			"are unexpected: %s", identifier.Ident, operands)
+		return nil
+	}
+	for i, operand := range operands {
+		if generated, ok := tr.generatedVariables[operand]; ok {
+			operands[i] = generated.Variable
+		} else if strings.Contains(operand, macrosNamespace+".") {
+			logrus.Warnf("Argument %s of function \"%s\" invokes a template definition, which the installed tasks "+
+				"can't evaluate;  replace it with an expression of role variables", operand, identifier.Ident)
+		}
+	}
+	value := &GeneratedValue{
+		Template: tr.Name,
+		Variable: tr.generatedVariableName(command, identifier.Ident),
+		Function: identifier.Ident,
+		Operands: operands,
+		Keys:     map[string]string{},
+	}
+	if command == tr.declaredCommand {
+		if tr.generatedVariables == nil {
+			tr.generatedVariables = map[string]*GeneratedValue{}
+		}
+		tr.generatedVariables[tr.declaredVariable] = value
+	} else if tr.secretDataKey != "" {
+		value.Keys[""] = tr.secretDataKey
+	}
+	if tr.generatedCommands == nil {
+		tr.generatedCommands = map[Node]*GeneratedValue{}
+	}
+	tr.generatedCommands[command] = value
+	tr.generatedValues = append(tr.generatedValues, value)
+	logrus.Warnf("Function \"%s\" in Secret template \"%s\" was converted to the variable \"%s\", which the installed "+
+		"tasks read from the existing Secret, and only generate when the Secret doesn't store it yet", value.Function,
+		value.Template, value.Variable)
+	return value
+}
+
+// Names the variable of a value generated by the tree after the template and the variable declared or the data key
+// being written, falling back to the function name.  Names are made unique by a numeric suffix.
+func (t *Tree) generatedVariableName(command Node, function string) string {
+	template := path.Base(t.Name)
+	if i := strings.Index(template, "."); i > 0 {
+		template = template[:i]
+	}
+	name := function
+	if command == t.declaredCommand {
+		name = strings.TrimPrefix(t.declaredVariable, jinja2VariablePrefix)
+	} else if t.secretDataKey != "" {
+		name = t.secretDataKey
+	}
+	variable := generatedVariablePrefix + snakeIdentifier(template) + "_" + snakeIdentifier(name)
+	unique := variable
+	for n := 2; t.isGeneratedVariable(unique); n++ {
+		unique = variable + "_" + strconv.Itoa(n)
+	}
+	return unique
+}
+
+// Translates a name, such as "Secret" or "tls.crt", into a snake_case identifier.
+func snakeIdentifier(name string) string {
+	return strings.Trim(paramconv.ToSnake(MacroName(name)), "_")
+}
+
+func (t *Tree) isGeneratedVariable(variable string) bool {
+	for _, value := range t.generatedValues {
+		if value.Variable == variable {
+			return true
+		}
+	}
+	return false
+}
+
+// Records the data key being written as storing a generated value, when a variable holding it (or its "Cert" or "Key"
+// field) is referenced.  Only the first data key is recorded.
+func (t *Tree) recordGeneratedValueUsage(ident []string) {
+	if t == nil || t.secretDataKey == "" || len(ident) > 2 {
+		return
+	}
+	value, ok := t.generatedVariables[variableName(ident[0])]
+	if !ok {
+		return
+	}
+	field := ""
+	if len(ident) == 2 {
+		field = ident[1]
+	}
+	if _, ok := value.Keys[field]; !ok {
+		value.Keys[field] = t.secretDataKey
+	}
+}
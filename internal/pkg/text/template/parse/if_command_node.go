@@ -9,6 +9,15 @@ import (
 
 const valuesPrefix = ".Values"
 
+// GoTruthiness selects Go truthiness for the values tested by "if" conditions.  Go treats empty strings, collections
+// and zero as false, which a definition check doesn't, so each value is tested as "x is defined and x" instead of
+// using the heuristic described in IfNode.
+var GoTruthiness bool
+
+// GoTruthinessPaths lists the paths of values, such as "ingress.tls", which are tested with Go truthiness regardless of
+// GoTruthiness.  The values nested within a path are selected as well.
+var GoTruthinessPaths []string
+
 // IfCommandNode holds a command (a pipeline inside an "if" statement).  Since
 type IfCommandNode struct {
 	NodeType
@@ -32,32 +41,64 @@ func (c *IfCommandNode) String() string {
 }
 
 func (c *IfCommandNode) writeTo(sb *strings.Builder) {
-	// Handles problem #2 of if-conditional conversion;  the "boolean composition problem".
-	if commandNodeInversionIsRequired(&c.Args) {
-		positionInFile := c.Position()
-
-		logrus.Infof("Found an Argument sequence at position %d that requires Jinja2 syntax normalization: %s",
-			positionInFile, c.Args)
-		invertCommandNodes(&c.Args)
-		logrus.Infof("Conversion at position %d became %s", positionInFile, c.Args)
+	// Such as: "{{ if index .Values.annotations "kubernetes.io/ingress.class" }}"
+	if isIndexInvocation(c.Args) {
+		writeIndexInvocationTo(sb, c.Args)
+		return
 	}
 
 	for i, arg := range c.Args {
 		if i > 0 {
 			sb.WriteByte(' ')
 		}
-		if arg, ok := arg.(*IfPipeNode); ok {
-			sb.WriteByte('(')
-			arg.writeTo(sb)
-			sb.WriteByte(')')
-			continue
-		}
-		if isValueNode(arg.String()) {
-			writeValueNode(&arg, sb)
-		} else {
-			arg.writeTo(sb)
-		}
+		writeConditionArgTo(sb, arg)
+	}
+}
+
+// Writes an argument of an "if" command, which is evaluated for truthiness.
+func writeConditionArgTo(sb *strings.Builder, arg Node) {
+	if arg, ok := arg.(*IfPipeNode); ok {
+		sb.WriteByte('(')
+		arg.writeTo(sb)
+		sb.WriteByte(')')
+		return
+	}
+	if isValueNode(arg.String()) {
+		writeValueNode(&arg, sb)
+	} else if isScopedFieldNode(arg) {
+		// The values of a field of a loop item, "with" alias or macro argument can't be looked up in the chart's values,
+		// so the field is tested with Go truthiness, which is also correct for a boolean.
+		field := arg.String()
+		logrus.Infof("Testing %s at position %d with Go truthiness", field, arg.Position())
+		sb.WriteString(field + " is defined and " + field)
+	} else {
+		arg.writeTo(sb)
+	}
+}
+
+// Determines whether an argument is a field of a rebound ".", such as ".tls" within a "range", or of a variable, such
+// as "$host.tls".  Either may be missing, which raises an error in Ansible unless the field is tested for definition.
+func isScopedFieldNode(arg Node) bool {
+	switch n := arg.(type) {
+	case *FieldNode:
+		return currentScope().dot != "" && !isHelmBuiltinObjectReference(n.Ident) &&
+			rootContextArgumentReference(n.Ident) == 0
+	case *VariableNode:
+		return len(n.Ident) > 1 && n.Ident[0] != goVariablePrefix
+	}
+	return false
+}
+
+// Returns a command of an "if" as a CommandNode, which writes its arguments as values rather than conditions.  Other
+// commands are returned as is.
+func valueCommand(command Node) Node {
+	c, ok := command.(*IfCommandNode)
+	if !ok {
+		return command
 	}
+	n := c.tr.newCommand(c.Pos)
+	n.Args = c.Args
+	return n
 }
 
 func (c *IfCommandNode) tree() *Tree {
@@ -75,26 +116,6 @@ func (c *IfCommandNode) Copy() Node {
 	return n
 }
 
-// Determine whether we need to invert nodes of the subtree to output in a Jinja2 compliant way.
-func commandNodeInversionIsRequired(args *[]Node) bool {
-	// CommandNode abstractions are used as the conditional clause in "if" statements.  In order to process an Args
-	// array for "if" containing "and", "or", or "eq" we must invert the first and second elements of the Args array.
-	// In other words, ["and", "condition1", "condition2"] will become ["condition1", "and", "condition2"].  This
-	// functionality determines whether inversion is necessary.
-	argsArray := *args
-	return len(argsArray) > 2 &&
-		(argsArray[0].String() == "and" || argsArray[0].String() == "or" || argsArray[0].String() == "eq")
-}
-
-// Side-effects the input array in order to swap elements at indexes 0 and 1.  This method does not check array length
-// and expects well formed input.
-func invertCommandNodes(args *[]Node) {
-	argsArray := *args
-	temp := argsArray[0]
-	argsArray[0] = argsArray[1]
-	argsArray[1] = temp
-}
-
 func isValueNode(nodeString string) bool {
 	return strings.HasPrefix(nodeString, ".Values.")
 }
@@ -113,6 +134,11 @@ func writeValueNode(fieldNodeRef *Node, sb *strings.Builder) {
 	if ReplaceWithSnakeCase && strings.HasPrefix(fieldNodeString, valuesPrefix) {
 		emittedField = paramconv.ToSnake(unqualifiedName)
 	}
+	if GoTruthiness || isGoTruthinessPath(unqualifiedName) || isGoTruthinessPath(emittedField) {
+		logrus.Infof("Testing %s at position %d with Go truthiness", emittedField, fieldNodePosition)
+		sb.WriteString(emittedField + " is defined and " + emittedField)
+		return
+	}
 	fieldIsLikelyBoolean, err := helm.ArgIsLikelyBooleanYamlValue(unqualifiedName)
 	if err != nil {
 		logrus.Warnf("\"%s\" at position %d was not found in Helm chart's values: %s.  Defaulting to definition conversion",
@@ -128,4 +154,14 @@ func writeValueNode(fieldNodeRef *Node, sb *strings.Builder) {
 		sb.WriteString(emittedField)
 		sb.WriteString(" is defined")
 	}
-}
\ No newline at end of file
+}
+
+// Determines whether a value is selected for Go truthiness by GoTruthinessPaths.
+func isGoTruthinessPath(path string) bool {
+	for _, selected := range GoTruthinessPaths {
+		if path == selected || strings.HasPrefix(path, selected+".") {
+			return true
+		}
+	}
+	return false
+}
@@ -32,6 +32,12 @@ import "strings"
 //
 //    Note:  You must uncomment optional configuration in order for this heuristic to work accurately.
 //
+//    Go treats empty strings, collections and zero as false, so a definition check renders sections which Helm skips.
+//    GoTruthiness (for all values) and GoTruthinessPaths (for the values under the given paths) select a test which
+//    matches Go instead:
+//
+//    {% if something is defined and something %}
+//
 // 2. Boolean-Composition: Go Template language treats boolean operators ("and", "or", "not") as function calls.  Thus,
 //    the syntax is "<booleanOperator> <condition1> <condition2>".  Treating such operators as function invocations is
 //    a common tactic in language development, as it significantly reduces the complexity of the parser.  However,
@@ -40,14 +46,21 @@ import "strings"
 //    operator, which works in a similar way to the Go template boolean operator implementation.  In these cases, the
 //    Abstract Syntax Tree nodes must be re-ordered in order to output proper Jinja2.  The "swapping" of nodes in memory
 //    is necessary since these statements can, and often are, heavily nested.
+//
+// Additionally, Go Template language expresses "else if" chains as an "if" nested within the "else" branch of the
+// preceding "if".  Jinja2 supports "elif", so such chains are flattened rather than output as nested conditionals:
+//
+//    {% if condition1 %}...{% elif condition2 %}...{% else %}...{% endif %}
 type IfNode struct {
 	NodeType
 	Pos
 	tr       *Tree
-	Line     int          // The line number in the input. Deprecated: Kept for compatibility.
-	Pipe     *IfPipeNode // The pipeline to be evaluated.
-	List     *ListNode   // What to execute if the value is non-empty.
-	ElseList *ListNode   // What to execute if the value is empty (nil if absent).
+	Line     int               // The line number in the input. Deprecated: Kept for compatibility.
+	Pipe     *IfPipeNode       // The pipeline to be evaluated.
+	List     *ListNode         // What to execute if the value is non-empty.
+	ElseList *ListNode         // What to execute if the value is empty (nil if absent).
+	IsElseIf bool              // Whether the conditional was introduced by "else if".
+	Trim     BranchTrimMarkers // The trim markers of the "if", "else" and "end" actions.
 }
 
 func (n *IfNode) String() string {
@@ -61,15 +74,43 @@ func (n *IfNode) writeTo(sb *strings.Builder) {
 	// https://github.com/golang/go/blob/master/src/text/template/parse/node.go#L822
 	// This is largely due to the fact that the "IfNode" type is abstracted to handle "if" statements specifically.
 	// Removal of the overloaded functionality allows greater specificity in outputting the Node.
-	sb.WriteString("{% if ")
+	n.Trim.Open.writeLeftTo(sb, statementLeftDelim)
+	sb.WriteString("if ")
 	n.Pipe.writeTo(sb)
-	sb.WriteString(" %}")
+	n.Trim.Open.writeRightTo(sb, statementRightDelim)
 	n.List.writeTo(sb)
-	if n.ElseList != nil {
-		sb.WriteString("{% else %}")
-		n.ElseList.writeTo(sb)
+	n.writeElseTo(sb)
+	n.Trim.End.writeStatementTo(sb, "endif")
+}
+
+// Writes the "else" branch of the conditional.  An "else if" is written as an "elif" branch, followed by the "else"
+// branch of the "else if", so that an arbitrarily long chain is written flat.
+func (n *IfNode) writeElseTo(sb *strings.Builder) {
+	if n.ElseList == nil {
+		return
+	}
+	if elseIf := n.elseIf(); elseIf != nil {
+		elseIf.Trim.Open.writeLeftTo(sb, statementLeftDelim)
+		sb.WriteString("elif ")
+		elseIf.Pipe.writeTo(sb)
+		elseIf.Trim.Open.writeRightTo(sb, statementRightDelim)
+		elseIf.List.writeTo(sb)
+		elseIf.writeElseTo(sb)
+		return
+	}
+	n.Trim.Else.writeStatementTo(sb, "else")
+	n.ElseList.writeTo(sb)
+}
+
+// Returns the conditional introduced by "else if", or nil if the "else" branch is not an "else if".
+func (n *IfNode) elseIf() *IfNode {
+	if len(n.ElseList.Nodes) != 1 {
+		return nil
+	}
+	if elseIf, ok := n.ElseList.Nodes[0].(*IfNode); ok && elseIf.IsElseIf {
+		return elseIf
 	}
-	sb.WriteString("{% endif %}")
+	return nil
 }
 
 func (t *Tree) newIf(pos Pos, line int, pipe *IfPipeNode, list, elseList *ListNode) *IfNode {
@@ -77,7 +118,10 @@ func (t *Tree) newIf(pos Pos, line int, pipe *IfPipeNode, list, elseList *ListNo
 }
 
 func (n *IfNode) Copy() Node {
-	return n.tr.newIf(n.Pos, n.Line, n.Pipe.CopyPipe(), n.List.CopyList(), n.ElseList.CopyList())
+	copied := n.tr.newIf(n.Pos, n.Line, n.Pipe.CopyPipe(), n.List.CopyList(), n.ElseList.CopyList())
+	copied.IsElseIf = n.IsElseIf
+	copied.Trim = n.Trim
+	return copied
 }
 
 func (n *IfNode) tree() *Tree {
@@ -33,12 +33,7 @@ func (t *Tree) newIfPipeline(pos Pos, line int, vars []*VariableNode) *IfPipeNod
 }
 
 func (p *IfPipeNode) writeTo(sb *strings.Builder) {
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.writeTo(sb)
-	}
+	writePipelineTo(sb, ifCommandNodes(p.Cmds))
 }
 
 func (p *IfPipeNode) tree() *Tree {
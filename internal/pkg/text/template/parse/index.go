@@ -0,0 +1,147 @@
+package parse
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"unicode"
+)
+
+// Go templates look up map keys and slice elements using the "index" function, which takes the collection followed by
+// any number of keys.  Jinja2 expresses the same lookup using subscripts.  For example:
+//
+// {{ index .Values.ingress.annotations "kubernetes.io/ingress.class" }}
+//
+// becomes:
+//
+// {{ .Values.ingress.annotations['kubernetes.io/ingress.class'] }}
+//
+// Helm values are exported as top-level Ansible variables, so ".Values" is not a dictionary of its own.  When ".Values"
+// itself is indexed, the first key names the Ansible variable.  If that key is not a valid Jinja2 identifier, such as
+// the hyphenated name of a subchart, the variable is looked up in the "vars" dictionary instead:
+//
+// {{ index .Values "etcd-operator" "cluster" "name" }}
+//
+// becomes:
+//
+// {{ vars['etcd-operator']['cluster']['name'] }}
+//
+// Keys of Helm values are converted to snake_case along with the defaults, so "etcd-operator" becomes "etcd_operator"
+// (an identifier) when snake_case conversion is enabled.  Field paths use the same bracket syntax for any key which
+// is not a valid Jinja2 identifier.
+
+const indexFunction = "index"
+
+// Whether a key may be written using Jinja2 attribute syntax (".key").
+func isJinja2Identifier(key string) bool {
+	if key == "" {
+		return false
+	}
+	for i, r := range key {
+		if r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r)) {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// Returns a Jinja2 string literal, such as 'etcd-operator'.
+func jinja2String(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`).Replace(s) + "'"
+}
+
+// Writes a literal Jinja2 subscript, such as "['etcd-operator']".
+func writeSubscriptTo(sb *strings.Builder, key string) {
+	sb.WriteString("[" + jinja2String(key) + "]")
+}
+
+// dictionaryMethods are the methods of a Python dictionary.  Jinja2 resolves attribute syntax to a method before a key,
+// so "secret.items" refers to the method rather than the "items" key.
+var dictionaryMethods = map[string]bool{
+	"clear":      true,
+	"copy":       true,
+	"fromkeys":   true,
+	"get":        true,
+	"items":      true,
+	"keys":       true,
+	"pop":        true,
+	"popitem":    true,
+	"setdefault": true,
+	"update":     true,
+	"values":     true,
+}
+
+// Writes a single segment of a field path, such as ".name" or "['etcd-operator']".  Keys which name a dictionary method,
+// such as "items", are written as subscripts.
+func writeFieldKeyTo(sb *strings.Builder, key string) {
+	if isJinja2Identifier(key) && !dictionaryMethods[key] {
+		sb.WriteByte('.')
+		sb.WriteString(key)
+		return
+	}
+	writeSubscriptTo(sb, key)
+}
+
+// Determines whether the arguments of a command are an invocation of "index", such as:
+// {{ index .Values.annotations "kubernetes.io/ingress.class" }}
+func isIndexInvocation(args []Node) bool {
+	if len(args) < 2 {
+		return false
+	}
+	identifier, ok := args[0].(*IdentifierNode)
+	return ok && identifier.Ident == indexFunction
+}
+
+// Determines whether a node is ".Values" itself (or "$.Values").
+func isValuesRoot(node Node) bool {
+	switch n := node.(type) {
+	case *FieldNode:
+		return len(n.Ident) == 1 && "."+n.Ident[0] == valuesPrefix
+	case *VariableNode:
+		return len(n.Ident) == 2 && n.Ident[0] == goVariablePrefix && "."+n.Ident[1] == valuesPrefix
+	}
+	return false
+}
+
+// Writes an invocation of "index" as a Jinja2 subscript expression.
+func writeIndexInvocationTo(sb *strings.Builder, args []Node) {
+	var b strings.Builder
+	collection := args[1]
+	keys := args[2:]
+	snakeCase := ReplaceWithSnakeCase && isValuesReference(collection)
+	if isValuesRoot(collection) && len(keys) > 0 {
+		if key, ok := keys[0].(*StringNode); ok && isJinja2Identifier(indexKey(key.Text, snakeCase)) {
+			b.WriteString(valuesPrefix + ".")
+			b.WriteString(indexKey(key.Text, snakeCase))
+			keys = keys[1:]
+		} else {
+			b.WriteString(rootContextVariable)
+		}
+	} else if _, ok := collection.(*PipeNode); ok {
+		b.WriteByte('(')
+		collection.writeTo(&b)
+		b.WriteByte(')')
+	} else {
+		collection.writeTo(&b)
+	}
+	for _, key := range keys {
+		if key, ok := key.(*StringNode); ok {
+			writeSubscriptTo(&b, indexKey(key.Text, snakeCase))
+			continue
+		}
+		b.WriteByte('[')
+		key.writeTo(&b)
+		b.WriteByte(']')
+	}
+	logrus.Infof("Index invocation converted to subscripts: %s -> %s", args, b.String())
+	sb.WriteString(b.String())
+}
+
+// Returns the key as it appears in the exported defaults.
+func indexKey(key string, snakeCase bool) string {
+	if snakeCase {
+		return paramconv.ToSnake(key)
+	}
+	return key
+}
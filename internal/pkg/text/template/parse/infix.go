@@ -0,0 +1,64 @@
+package parse
+
+import "strings"
+
+// Sprig's arithmetic, equality and membership functions, "cat" and Go's "printf" have no counterpart among Ansible
+// filters, but Jinja2 provides native operators for each of them.  These functions are rewritten as infix expressions:
+//
+// add a b c        ->  (a + b + c)
+// sub a b          ->  (a - b)
+// mul a b          ->  (a * b)
+// div a b          ->  (a // b)
+// mod a b          ->  (a % b)
+// add1 a           ->  (a + 1)
+// concat a b       ->  (a + b)
+// deepEqual a b    ->  (a == b)
+// contains a b     ->  (a in b)
+// has a b          ->  (a in b)
+// cat a b          ->  a ~ ' ' ~ b
+// printf "%s" a b  ->  "%s" | format(a, b)
+//
+// Arithmetic expressions are always parenthesized, so they can be nested or piped without regard to precedence.  Sprig
+// performs integer arithmetic, hence the floor division;  the floating point variants ("addf", "divf" and so on) use
+// true division.  Since Python's "%" formatting doesn't know Go's "%v" verb, it is replaced by "%s" within a literal
+// format string.
+
+// Returns the writer of an infix operator.  Variadic operators, like Sprig's "add" and "mul", accept any number of
+// operands beyond the first two.
+func infixOperator(operator string, variadic bool) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) < 2 || (!variadic && len(operands) > 2) {
+			return nil
+		}
+		expression := "(" + strings.Join(parenthesizeAll(operands), " "+operator+" ") + ")"
+		return &expression
+	}
+}
+
+func translateIncrement(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	expression := "(" + parenthesize(operands[0]) + " + 1)"
+	return &expression
+}
+
+func translateCat(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	expression := strings.Join(parenthesizeAll(operands), " ~ ' ' ~ ")
+	return &expression
+}
+
+func translatePrintf(operands []string) *string {
+	if len(operands) == 0 {
+		return nil
+	}
+	format := operands[0]
+	if strings.HasPrefix(format, `"`) || strings.HasPrefix(format, "'") {
+		format = strings.ReplaceAll(format, "%v", "%s")
+	}
+	expression := parenthesize(format) + " | format(" + strings.Join(operands[1:], ", ") + ")"
+	return &expression
+}
@@ -17,6 +17,7 @@ type item struct {
 	pos  Pos      // The starting position, in bytes, of this item in the input string.
 	val  string   // The value of this item.
 	line int      // The line number at the start of this item.
+	trim bool     // Whether a delimiter item carries a trim marker ("{{- " or " -}}").
 }
 
 func (i item) String() string {
@@ -41,6 +42,7 @@ const (
 	itemBool                         // boolean constant
 	itemChar                         // printable ASCII character; grab bag for comma etc.
 	itemCharConstant                 // character constant
+	itemComment                      // comment text, emitted only when comments are parsed
 	itemComplex                      // complex constant (1+2i); imaginary is just a number
 	itemAssign                       // equals ('=') introducing an assignment
 	itemDeclare                      // colon-equals (':=') introducing a declaration
@@ -119,6 +121,7 @@ type lexer struct {
 	parenDepth     int       // nesting depth of ( ) exprs
 	line           int       // 1+number of newlines seen
 	startLine      int       // start line of this item
+	emitComment    bool      // emit itemComment tokens, delimited as an action
 }
 
 // next returns the next rune in the input.
@@ -154,7 +157,13 @@ func (l *lexer) backup() {
 
 // emit passes an item back to the client.
 func (l *lexer) emit(t itemType) {
-	l.items <- item{t, l.start, l.input[l.start:l.pos], l.startLine}
+	l.emitTrimmed(t, false)
+}
+
+// emitTrimmed passes an item back to the client, recording whether the item is a delimiter with a trim marker.  The
+// whitespace is still trimmed by the lexer;  the marker is kept so that it may be reproduced in the Jinja2 output.
+func (l *lexer) emitTrimmed(t itemType, trim bool) {
+	l.items <- item{t, l.start, l.input[l.start:l.pos], l.startLine, trim}
 	l.start = l.pos
 	l.startLine = l.line
 }
@@ -185,7 +194,7 @@ func (l *lexer) acceptRun(valid string) {
 // errorf returns an error token and terminates the scan by passing
 // back a nil pointer that will be the next state, terminating l.nextItem.
 func (l *lexer) errorf(format string, args ...interface{}) stateFn {
-	l.items <- item{itemError, l.start, fmt.Sprintf(format, args...), l.startLine}
+	l.items <- item{itemError, l.start, fmt.Sprintf(format, args...), l.startLine, false}
 	return nil
 }
 
@@ -219,6 +228,7 @@ func lex(name, input, left, right string) *lexer {
 		items:          make(chan item),
 		line:           1,
 		startLine:      1,
+		emitComment:    ParseComments,
 	}
 	go l.run()
 	return l
@@ -300,11 +310,14 @@ func lexLeftDelim(l *lexer) stateFn {
 		afterMarker = trimMarkerLen
 	}
 	if strings.HasPrefix(l.input[l.pos+afterMarker:], leftComment) {
+		if l.emitComment {
+			l.emitTrimmed(itemLeftDelim, trimSpace)
+		}
 		l.pos += afterMarker
 		l.ignore()
 		return lexComment
 	}
-	l.emit(itemLeftDelim)
+	l.emitTrimmed(itemLeftDelim, trimSpace)
 	l.pos += afterMarker
 	l.ignore()
 	l.parenDepth = 0
@@ -323,6 +336,10 @@ func lexComment(l *lexer) stateFn {
 	if !delim {
 		return l.errorf("comment ends before closing delimiter")
 	}
+	if l.emitComment {
+		l.emit(itemComment)
+		return lexRightDelim
+	}
 	if trimSpace {
 		l.pos += trimMarkerLen
 	}
@@ -342,7 +359,7 @@ func lexRightDelim(l *lexer) stateFn {
 		l.ignore()
 	}
 	l.pos += Pos(len(l.rightDelim))
-	l.emit(itemRightDelim)
+	l.emitTrimmed(itemRightDelim, trimSpace)
 	if trimSpace {
 		l.pos += leftTrimLength(l.input[l.pos:])
 		l.ignore()
@@ -417,6 +417,9 @@ func equal(i1, i2 []item, checkPos bool) bool {
 		if checkPos && i1[k].line != i2[k].line {
 			return false
 		}
+		if checkPos && i1[k].trim != i2[k].trim {
+			return false
+		}
 	}
 	return true
 }
@@ -465,41 +468,41 @@ func TestDelims(t *testing.T) {
 }
 
 var lexPosTests = []lexTest{
-	{"empty", "", []item{{itemEOF, 0, "", 1}}},
+	{"empty", "", []item{{itemEOF, 0, "", 1, false}}},
 	{"punctuation", "{{,@%#}}", []item{
-		{itemLeftDelim, 0, "{{", 1},
-		{itemChar, 2, ",", 1},
-		{itemChar, 3, "@", 1},
-		{itemChar, 4, "%", 1},
-		{itemChar, 5, "#", 1},
-		{itemRightDelim, 6, "}}", 1},
-		{itemEOF, 8, "", 1},
+		{itemLeftDelim, 0, "{{", 1, false},
+		{itemChar, 2, ",", 1, false},
+		{itemChar, 3, "@", 1, false},
+		{itemChar, 4, "%", 1, false},
+		{itemChar, 5, "#", 1, false},
+		{itemRightDelim, 6, "}}", 1, false},
+		{itemEOF, 8, "", 1, false},
 	}},
 	{"sample", "0123{{hello}}xyz", []item{
-		{itemText, 0, "0123", 1},
-		{itemLeftDelim, 4, "{{", 1},
-		{itemIdentifier, 6, "hello", 1},
-		{itemRightDelim, 11, "}}", 1},
-		{itemText, 13, "xyz", 1},
-		{itemEOF, 16, "", 1},
+		{itemText, 0, "0123", 1, false},
+		{itemLeftDelim, 4, "{{", 1, false},
+		{itemIdentifier, 6, "hello", 1, false},
+		{itemRightDelim, 11, "}}", 1, false},
+		{itemText, 13, "xyz", 1, false},
+		{itemEOF, 16, "", 1, false},
 	}},
 	{"trimafter", "{{x -}}\n{{y}}", []item{
-		{itemLeftDelim, 0, "{{", 1},
-		{itemIdentifier, 2, "x", 1},
-		{itemRightDelim, 5, "}}", 1},
-		{itemLeftDelim, 8, "{{", 2},
-		{itemIdentifier, 10, "y", 2},
-		{itemRightDelim, 11, "}}", 2},
-		{itemEOF, 13, "", 2},
+		{itemLeftDelim, 0, "{{", 1, false},
+		{itemIdentifier, 2, "x", 1, false},
+		{itemRightDelim, 5, "}}", 1, true},
+		{itemLeftDelim, 8, "{{", 2, false},
+		{itemIdentifier, 10, "y", 2, false},
+		{itemRightDelim, 11, "}}", 2, false},
+		{itemEOF, 13, "", 2, false},
 	}},
 	{"trimbefore", "{{x}}\n{{- y}}", []item{
-		{itemLeftDelim, 0, "{{", 1},
-		{itemIdentifier, 2, "x", 1},
-		{itemRightDelim, 3, "}}", 1},
-		{itemLeftDelim, 6, "{{", 2},
-		{itemIdentifier, 10, "y", 2},
-		{itemRightDelim, 11, "}}", 2},
-		{itemEOF, 13, "", 2},
+		{itemLeftDelim, 0, "{{", 1, false},
+		{itemIdentifier, 2, "x", 1, false},
+		{itemRightDelim, 3, "}}", 1, false},
+		{itemLeftDelim, 6, "{{", 2, true},
+		{itemIdentifier, 10, "y", 2, false},
+		{itemRightDelim, 11, "}}", 2, false},
+		{itemEOF, 13, "", 2, false},
 	}},
 }
 
@@ -0,0 +1,146 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// MacrosFileName is the name of the file, within the Ansible Role templates directory, that collects the Jinja2
+// translation of every Helm template definition ("define" and "block"), including those found in _helpers.tpl.
+const MacrosFileName = "_macros.j2"
+
+const includeFunction = "include"
+const macroContext = "context"
+const macrosNamespace = "macros"
+const macrosImport = "{% import '" + MacrosFileName + "' as " + macrosNamespace + " with context -%}\n"
+
+// MacroName translates a Helm template name into a valid Jinja2 identifier.  Helm template names are conventionally
+// namespaced by the chart name (i.e., "nginx.fullname"), which is not a valid Jinja2 identifier.  Thus, any character
+// which is not a letter, digit or underscore is replaced with an underscore (i.e., "nginx_fullname").
+func MacroName(templateName string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, templateName)
+}
+
+// MacroString returns the translation of a template definition tree into a Jinja2 macro.  Go passes exactly one value
+// to a template definition, which becomes "." within the definition.  The macro mirrors this with a single "context"
+// argument, and "." references within the body are written in terms of it.  For example:
+//
+// {{- define "nginx.name" -}}
+// {{ .name | trunc 63 }}
+// {{- end -}}
+//
+// becomes:
+//
+// {%- macro nginx_name(context=none) -%}
+// {{ context.name | trunc(63) }}
+// {%- endmacro %}
+func (t *Tree) MacroString() string {
+	var sb strings.Builder
+	pushScope(scope{dot: macroContext, macro: true})
+	defer popScope()
+	if t.doc != nil {
+		t.doc.writeTo(&sb)
+		sb.WriteString("\n")
+	}
+	t.definitionTrim.Open.writeLeftTo(&sb, statementLeftDelim)
+	sb.WriteString("macro ")
+	sb.WriteString(MacroName(t.Name))
+	sb.WriteString("(" + macroContext + "=none)")
+	t.definitionTrim.Open.writeRightTo(&sb, statementRightDelim)
+	t.Root.writeTo(&sb)
+	t.definitionTrim.End.writeStatementTo(&sb, "endmacro")
+	return sb.String()
+}
+
+// Macros returns the contents of the Jinja2 macros file for a set of template definitions, ordered by name so the
+// output is stable across runs.
+func Macros(definitions map[string]*Tree) string {
+	names := make([]string, 0, len(definitions))
+	for name := range definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var sb strings.Builder
+	for _, name := range names {
+		sb.WriteString(definitions[name].MacroString())
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Jinja2 returns the Jinja2 translation of the tree.  If the tree invokes any template definition, the translation is
+// prefixed with the import of the macros file.
+func (t *Tree) Jinja2() string {
+	t.secretDataKey = ""
+	body := t.Root.String()
+	if t.callsMacros {
+		return macrosImport + body
+	}
+	return body
+}
+
+// Writes the invocation of the macro translated from the named template definition, passing argument as the macro
+// context.  Within a definition, sibling macros are in scope and are called directly.  Elsewhere, the call is qualified
+// by the namespace of the macros import, and the tree is marked as requiring the import.  The root context is never
+// passed, since Helm builtin objects are referenced globally within macros.
+func writeMacroInvocation(sb *strings.Builder, tr *Tree, name string, argument Node) {
+	var b strings.Builder
+	if !inMacro() {
+		b.WriteString(macrosNamespace + ".")
+		if tr != nil {
+			tr.callsMacros = true
+		}
+	}
+	b.WriteString(MacroName(name))
+	b.WriteByte('(')
+	if argument != nil && !isRootContext(argument) {
+		argument.writeTo(&b)
+	}
+	b.WriteByte(')')
+	logrus.Infof("Template invocation of \"%s\" converted to macro call: %s", name, b.String())
+	sb.WriteString(b.String())
+}
+
+// Determines whether a node refers to the root context of the template, i.e., "." or "$" outside of any rebinding.
+func isRootContext(node Node) bool {
+	switch n := node.(type) {
+	case *PipeNode:
+		return len(n.Decl) == 0 && len(n.Cmds) == 1 && len(n.Cmds[0].Args) == 1 && isRootContext(n.Cmds[0].Args[0])
+	case *DotNode:
+		return currentScope().dot == ""
+	case *VariableNode:
+		return len(n.Ident) == 1 && n.Ident[0] == "$" && !inMacro()
+	}
+	return false
+}
+
+// Determines whether the command is an "include" of a template definition, such as:
+// {{ include "nginx.fullname" . }}
+func (c *CommandNode) isTemplateInclusion() bool {
+	if c.PipeNodeCount != 0 || len(c.Args) < 2 || len(c.Args) > 3 {
+		return false
+	}
+	identifier, ok := c.Args[0].(*IdentifierNode)
+	if !ok || identifier.Ident != includeFunction {
+		return false
+	}
+	_, ok = c.Args[1].(*StringNode)
+	return ok
+}
+
+// Writes an "include" of a template definition as a macro invocation.
+func (c *CommandNode) writeTemplateInclusion(sb *strings.Builder) {
+	var argument Node
+	if len(c.Args) == 3 {
+		argument = c.Args[2]
+	}
+	writeMacroInvocation(sb, c.tr, c.Args[1].(*StringNode).Text, argument)
+}
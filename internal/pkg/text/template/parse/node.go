@@ -84,6 +84,7 @@ const (
 	NodeTemplate                   // A template invocation action.
 	NodeVariable                   // A $ variable.
 	NodeWith                       // A with action.
+	NodeComment                    // A comment.
 )
 
 // Nodes.
@@ -157,6 +158,7 @@ func (t *TextNode) writeTo(sb *strings.Builder) {
 		// Restrict replacements to keys by appending the yaml separator
 		original = strings.ReplaceAll(original, key + ":", snakeKey + ":")
 	}
+	t.tr.recordSecretDataKey(original)
 	sb.WriteString(original)
 }
 
@@ -203,13 +205,12 @@ func (p *PipeNode) writeTo(sb *strings.Builder) {
 		}
 		sb.WriteString(" := ")
 	}
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.PipeNodeCount = i
-		c.writeTo(sb)
-	}
+	p.writeExpressionTo(sb)
+}
+
+// Writes the commands of the pipeline, omitting any variable declaration.
+func (p *PipeNode) writeExpressionTo(sb *strings.Builder) {
+	writePipelineTo(sb, commandNodes(p.Cmds))
 }
 
 func (p *PipeNode) tree() *Tree {
@@ -243,8 +244,9 @@ type ActionNode struct {
 	NodeType
 	Pos
 	tr   *Tree
-	Line int       // The line number in the input. Deprecated: Kept for compatibility.
-	Pipe *PipeNode // The pipeline in the action.
+	Line int         // The line number in the input. Deprecated: Kept for compatibility.
+	Pipe *PipeNode   // The pipeline in the action.
+	Trim TrimMarkers // The trim markers of the action delimiters.
 }
 
 func (t *Tree) newAction(pos Pos, line int, pipe *PipeNode) *ActionNode {
@@ -258,9 +260,14 @@ func (a *ActionNode) String() string {
 }
 
 func (a *ActionNode) writeTo(sb *strings.Builder) {
-	sb.WriteString("{{ ")
+	// Such as: "{{ $name := .Values.name }}"
+	if len(a.Pipe.Decl) > 0 {
+		a.writeVariableDeclarationTo(sb)
+		return
+	}
+	a.Trim.writeLeftTo(sb, expressionLeftDelim)
 	a.Pipe.writeTo(sb)
-	sb.WriteString(" }}")
+	a.Trim.writeRightTo(sb, expressionRightDelim)
 }
 
 func (a *ActionNode) tree() *Tree {
@@ -268,8 +275,9 @@ func (a *ActionNode) tree() *Tree {
 }
 
 func (a *ActionNode) Copy() Node {
-	return a.tr.newAction(a.Pos, a.Line, a.Pipe.CopyPipe())
-
+	copied := a.tr.newAction(a.Pos, a.Line, a.Pipe.CopyPipe())
+	copied.Trim = a.Trim
+	return copied
 }
 
 // CommandNode holds a command (a pipeline inside an evaluating action).
@@ -387,13 +395,22 @@ func rewritePipedFunctionOutput(sb *strings.Builder, argsPointer *[]Node) {
 }
 
 func (c *CommandNode) writeTo(sb *strings.Builder) {
-	// Handles problem #2 of if-conditional conversion;  the "boolean composition problem".
-	if commandNodeInversionIsRequired(&c.Args) {
-		positionInFile := c.Position()
-		logrus.Infof("Found an Argument sequence at position %d that requires Jinja2 syntax normalization: %s",
-			positionInFile, c.Args)
-		invertCommandNodes(&c.Args)
-		logrus.Infof("Conversion at position %d became %s", positionInFile, c.Args)
+	// Such as: "{{ include (print $.Template.BasePath "/configmap.yaml") . }}"
+	if c.isTemplateFileInclusion() {
+		c.writeTemplateFileLookup(sb)
+		return
+	}
+
+	// Such as: "{{ include "nginx.fullname" . }}"
+	if c.isTemplateInclusion() {
+		c.writeTemplateInclusion(sb)
+		return
+	}
+
+	// Such as: "{{ index .Values "etcd-operator" "cluster" }}"
+	if c.PipeNodeCount == 0 && isIndexInvocation(c.Args) {
+		writeIndexInvocationTo(sb, c.Args)
+		return
 	}
 
 	// Such as: "{{ toYaml .Values.something '.' }}
@@ -492,11 +509,25 @@ func (v *VariableNode) String() string {
 }
 
 func (v *VariableNode) writeTo(sb *strings.Builder) {
+	if v.Ident[0] == goVariablePrefix {
+		v.writeRootReferenceTo(sb)
+		return
+	}
+	// The fields of a variable bound to the chart's values by a "range" or "with" are converted as the defaults are.
+	values := isValuesVariable(variableName(v.Ident[0]))
 	for i, id := range v.Ident {
 		if i > 0 {
-			sb.WriteByte('.')
+			if values {
+				id = snakeCaseFields([]string{id})[0]
+			}
+			writeFieldKeyTo(sb, id)
+			continue
+		}
+		v.tr.recordGeneratedValueUsage(v.Ident)
+		sb.WriteString(variableName(id))
+		if v.tr.isNamespacedVariable(id) {
+			sb.WriteString("." + namespaceAttribute)
 		}
-		sb.WriteString(id)
 	}
 }
 
@@ -527,11 +558,17 @@ func (d *DotNode) Type() NodeType {
 }
 
 func (d *DotNode) String() string {
-	return "."
+	var sb strings.Builder
+	d.writeTo(&sb)
+	return sb.String()
 }
 
 func (d *DotNode) writeTo(sb *strings.Builder) {
-	sb.WriteString(d.String())
+	if dot := currentScope().dot; dot != "" {
+		sb.WriteString(dot)
+		return
+	}
+	sb.WriteByte('.')
 }
 
 func (d *DotNode) tree() *Tree {
@@ -597,10 +634,8 @@ func (f *FieldNode) String() string {
 }
 
 func (f *FieldNode) writeTo(sb *strings.Builder) {
-	for _, id := range f.Ident {
-		sb.WriteByte('.')
-		sb.WriteString(id)
-	}
+	// Within a rebinding of ".", fields are written relative to the rebound expression.
+	writeFieldsTo(sb, currentScope(), f.Ident)
 }
 
 func (f *FieldNode) tree() *Tree {
@@ -653,7 +688,6 @@ func (c *ChainNode) writeTo(sb *strings.Builder) {
 		c.Node.writeTo(sb)
 	}
 	for _, field := range c.Field {
-		sb.WriteByte('.')
 		emittedField := field
 		if ReplaceWithSnakeCase && c.Node.String() == valuesPrefix {
 			emittedField = paramconv.ToSnake(field)
@@ -664,7 +698,7 @@ func (c *ChainNode) writeTo(sb *strings.Builder) {
 			// Does conversion in defaults/main.yaml.
 			SubstituteSnakeCaseDefaultValue(field, emittedField)
 		}
-		sb.WriteString(emittedField)
+		writeFieldKeyTo(sb, emittedField)
 	}
 }
 
@@ -885,7 +919,8 @@ func (s *StringNode) Copy() Node {
 type endNode struct {
 	NodeType
 	Pos
-	tr *Tree
+	tr   *Tree
+	Trim TrimMarkers // The trim markers of the action delimiters.
 }
 
 func (t *Tree) newEnd(pos Pos) *endNode {
@@ -905,7 +940,9 @@ func (e *endNode) tree() *Tree {
 }
 
 func (e *endNode) Copy() Node {
-	return e.tr.newEnd(e.Pos)
+	copied := e.tr.newEnd(e.Pos)
+	copied.Trim = e.Trim
+	return copied
 }
 
 // elseNode represents an {{else}} action. Does not appear in the final tree.
@@ -913,7 +950,8 @@ type elseNode struct {
 	NodeType
 	Pos
 	tr   *Tree
-	Line int // The line number in the input. Deprecated: Kept for compatibility.
+	Line int         // The line number in the input. Deprecated: Kept for compatibility.
+	Trim TrimMarkers // The trim markers of the action delimiters.
 }
 
 func (t *Tree) newElse(pos Pos, line int) *elseNode {
@@ -925,11 +963,13 @@ func (e *elseNode) Type() NodeType {
 }
 
 func (e *elseNode) String() string {
-	return "{% else %}"
+	var sb strings.Builder
+	e.writeTo(&sb)
+	return sb.String()
 }
 
 func (e *elseNode) writeTo(sb *strings.Builder) {
-	sb.WriteString(e.String())
+	e.Trim.writeStatementTo(sb, "else")
 }
 
 func (e *elseNode) tree() *Tree {
@@ -937,7 +977,9 @@ func (e *elseNode) tree() *Tree {
 }
 
 func (e *elseNode) Copy() Node {
-	return e.tr.newElse(e.Pos, e.Line)
+	copied := e.tr.newElse(e.Pos, e.Line)
+	copied.Trim = e.Trim
+	return copied
 }
 
 // TemplateNode represents a {{template}} action.
@@ -945,9 +987,10 @@ type TemplateNode struct {
 	NodeType
 	Pos
 	tr   *Tree
-	Line int       // The line number in the input. Deprecated: Kept for compatibility.
-	Name string    // The name of the template (unquoted).
-	Pipe *PipeNode // The command to evaluate as dot for the template.
+	Line int         // The line number in the input. Deprecated: Kept for compatibility.
+	Name string      // The name of the template (unquoted).
+	Pipe *PipeNode   // The command to evaluate as dot for the template.
+	Trim TrimMarkers // The trim markers of the action delimiters.
 }
 
 func (t *Tree) newTemplate(pos Pos, line int, name string, pipe *PipeNode) *TemplateNode {
@@ -960,14 +1003,16 @@ func (t *TemplateNode) String() string {
 	return sb.String()
 }
 
+// Writes the Jinja2 translation of a {{template}} action, which is an invocation of the macro translated from the
+// named template definition.  For example, {{ template "nginx.fullname" . }} becomes {{ macros.nginx_fullname() }}.
 func (t *TemplateNode) writeTo(sb *strings.Builder) {
-	sb.WriteString("{{ template ")
-	sb.WriteString(strconv.Quote(t.Name))
+	t.Trim.writeLeftTo(sb, expressionLeftDelim)
+	var argument Node
 	if t.Pipe != nil {
-		sb.WriteByte(' ')
-		t.Pipe.writeTo(sb)
+		argument = t.Pipe
 	}
-	sb.WriteString(" }}")
+	writeMacroInvocation(sb, t.tr, t.Name, argument)
+	t.Trim.writeRightTo(sb, expressionRightDelim)
 }
 
 func (t *TemplateNode) tree() *Tree {
@@ -975,5 +1020,7 @@ func (t *TemplateNode) tree() *Tree {
 }
 
 func (t *TemplateNode) Copy() Node {
-	return t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	copied := t.tr.newTemplate(t.Pos, t.Line, t.Name, t.Pipe.CopyPipe())
+	copied.Trim = t.Trim
+	return copied
 }
@@ -9,11 +9,14 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"strings"
 	"testing"
 )
 
 const defaultPermissions = 0600
+const expectedFileSuffix = ".j2"
+const helmPartialFilePrefix = "_"
 const helmTemplatesDirectory = "templates"
 const scratchValuesFileSuffix = ".scratch"
 const valuesFileName = "values.yaml"
@@ -49,6 +52,114 @@ var testCases = []testCase{
 		"basic_with",
 		"testdata/basic_with",
 	},
+	{
+		"with_scope",
+		"testdata/with_scope",
+	},
+	{
+		"else_if_chain",
+		"testdata/else_if_chain",
+	},
+	{
+		"variables",
+		"testdata/variables",
+	},
+	{
+		"root_context",
+		"testdata/root_context",
+	},
+	{
+		"template_definitions",
+		"testdata/template_definitions",
+	},
+	{
+		"trim_markers",
+		"testdata/trim_markers",
+	},
+	{
+		"comments",
+		"testdata/comments",
+	},
+	{
+		"index",
+		"testdata/index",
+	},
+	{
+		"argument_order",
+		"testdata/argument_order",
+	},
+	{
+		"infix",
+		"testdata/infix",
+	},
+	{
+		"filter_mappings",
+		"testdata/filter_mappings",
+	},
+	{
+		"builtins",
+		"testdata/builtins",
+	},
+	{
+		"comparisons",
+		"testdata/comparisons",
+	},
+	{
+		"collections",
+		"testdata/collections",
+	},
+	{
+		"serialization",
+		"testdata/serialization",
+	},
+	{
+		"checksum",
+		"testdata/checksum",
+	},
+	{
+		"builtin_objects",
+		"testdata/builtin_objects",
+	},
+	{
+		"capabilities",
+		"testdata/capabilities",
+	},
+	{
+		"lookup",
+		"testdata/lookup",
+	},
+	{
+		"generators",
+		"testdata/generators",
+	},
+	{
+		"template_strings",
+		"testdata/template_strings",
+	},
+	{
+		"range_maps",
+		"testdata/range_maps",
+	},
+	{
+		"range_index",
+		"testdata/range_index",
+	},
+	{
+		"range_scopes",
+		"testdata/range_scopes",
+	},
+	{
+		"nginx_helpers",
+		"testdata/nginx_helpers",
+	},
+	{
+		"regex_replacements",
+		"testdata/regex_replacements",
+	},
+	{
+		"empty_values",
+		"testdata/empty_values",
+	},
 }
 
 // Reads the files in a directory, exiting fatally if any errors occur.
@@ -111,49 +222,189 @@ func cleanupScratchFile(scratchValuesFile, valuesFile string) {
 	}
 }
 
+// Collects the template definitions parsed alongside a test template.
+func collectDefinitions(template *template2.Template, definitions map[string]*parse.Tree) {
+	for _, definition := range template.Templates() {
+		if definition.Name() != template.Name() {
+			definitions[definition.Name()] = definition.Tree
+		}
+	}
+}
+
+// Compares the macros translated from the definitions of a test case against the expected macros file, if any.
+func verifyMacros(chartDir string, definitions map[string]*parse.Tree, t *testing.T) {
+	expectedFileName := path.Join(chartDir, parse.MacrosFileName)
+	expectedByte, err := ioutil.ReadFile(expectedFileName)
+	if err != nil {
+		if len(definitions) > 0 {
+			t.Errorf("Could not load expected macros file: %s", expectedFileName)
+		}
+		return
+	}
+	expected := strings.TrimSpace(string(expectedByte))
+	actual := strings.TrimSpace(parse.Macros(definitions))
+	if expected != actual {
+		t.Errorf("Macro translation error.  Expected=%s Actual=%s", expected, actual)
+	}
+}
+
 func TestToString(t *testing.T) {
-	var scratchValuesFiles []string
 	parse.ReplaceWithSnakeCase = true
+	parse.ParseComments = true
+	defer func() { parse.ParseComments = false }()
 
 	for _, testCase := range testCases {
-		logrus.Infof("Running: %s", testCase.name)
-		templatesDirectory := path.Join(testCase.chartDir, helmTemplatesDirectory)
-		templateFiles, err := readDir(templatesDirectory, t)
+		verifyTestCase(testCase, expectedFileSuffix, t)
+	}
+}
+
+// Verifies the translation of each template of a test case against the expected file with the given suffix, and the
+// translation of the template definitions.
+func verifyTestCase(testCase testCase, expectedSuffix string, t *testing.T) {
+	logrus.Infof("Running: %s", testCase.name)
+	var scratchValuesFiles []string
+	definitions := map[string]*parse.Tree{}
+	templatesDirectory := path.Join(testCase.chartDir, helmTemplatesDirectory)
+	templateFiles, err := readDir(templatesDirectory, t)
+	if err != nil {
+		t.Errorf("Couldn't read: %s", templatesDirectory)
+	}
+	for _, file := range templateFiles {
+		scratchValuesFile, err := generateScratchValuesFile(testCase.chartDir)
+		if err != nil {
+			t.Errorf("Couldn't create the scratch file %s", scratchValuesFile)
+		}
+		scratchValuesFiles = append(scratchValuesFiles, scratchValuesFile)
+		// Inject values reference.
+		parse.DefaultsFile = path.Join(testCase.chartDir, valuesFileName)
+		testFileName := file.Name()
+		cwd, _ := os.Getwd()
+		helm.HelmChartRef = path.Join(cwd, testCase.chartDir)
+		templateFilePath := path.Join(templatesDirectory, testFileName)
+		template, err := template2.New(testFileName).
+			Option("missingkey=zero").
+			Funcs(template2.HelmFuncMap()).
+			ParseFiles(templateFilePath)
 		if err != nil {
-			t.Errorf("Couldn't read: %s", templatesDirectory)
+			t.Errorf("Unexpected error while parsing %s: %s", testFileName, err)
 		}
-		for _, file := range templateFiles {
-			scratchValuesFile, err := generateScratchValuesFile(testCase.chartDir)
-			if err != nil {
-				t.Errorf("Couldn't create the scratch file %s", scratchValuesFile)
-			}
-			scratchValuesFiles = append(scratchValuesFiles, scratchValuesFile)
-			// Inject values reference.
-			parse.DefaultsFile = path.Join(testCase.chartDir, valuesFileName)
-			testFileName := file.Name()
-			cwd, _ := os.Getwd()
-			helm.HelmChartRef = path.Join(cwd, testCase.chartDir)
-			templateFilePath := path.Join(templatesDirectory, testFileName)
-			template, err := template2.New(testFileName).
-				Option("missingkey=zero").
-				Funcs(template2.HelmFuncMap()).
-				ParseFiles(templateFilePath)
-			if err != nil {
-				t.Errorf("Unexpected error while parsing %s: %s", testFileName, err)
-			}
-			expectedFileName := path.Join(testCase.chartDir, testFileName+".j2")
-			expectedByte, err := ioutil.ReadFile(expectedFileName)
-			if err != nil {
-				t.Errorf("Could not load expected file: %s", expectedFileName)
-			}
-			expected := string(expectedByte)
-			expected = strings.TrimSpace(expected)
-			actual := strings.TrimSpace(template.Root.String())
-			if expected != actual {
-				t.Errorf("Parsing error.  Expected=%s Actual=%s", expected, actual)
-			}
+		collectDefinitions(template, definitions)
+		// Helm partials only contribute definitions, which are verified through the macros file.
+		if strings.HasPrefix(testFileName, helmPartialFilePrefix) {
 			cleanupScratchFile(scratchValuesFile, parse.DefaultsFile)
+			continue
+		}
+		expectedFileName := path.Join(testCase.chartDir, testFileName+expectedSuffix)
+		expectedByte, err := ioutil.ReadFile(expectedFileName)
+		if err != nil {
+			t.Errorf("Could not load expected file: %s", expectedFileName)
+		}
+		expected := string(expectedByte)
+		expected = strings.TrimSpace(expected)
+		actual := strings.TrimSpace(template.Tree.Jinja2())
+		if expected != actual {
+			t.Errorf("Parsing error.  Expected=%s Actual=%s", expected, actual)
+		}
+		cleanupScratchFile(scratchValuesFile, parse.DefaultsFile)
+	}
+	verifyMacros(testCase.chartDir, definitions, t)
+	cleanupScratchFiles(scratchValuesFiles)
+}
+
+// Verifies the translation of "if" conditions with Go truthiness, selected for some paths and for all values.
+func TestGoTruthiness(t *testing.T) {
+	parse.ReplaceWithSnakeCase = true
+	parse.GoTruthinessPaths = []string{"ingress", "name"}
+	verifyTestCase(testCase{"go_truthiness_paths", "testdata/go_truthiness"}, ".paths"+expectedFileSuffix, t)
+	parse.GoTruthinessPaths = nil
+	parse.GoTruthiness = true
+	defer func() { parse.GoTruthiness = false }()
+	verifyTestCase(testCase{"go_truthiness", "testdata/go_truthiness"}, expectedFileSuffix, t)
+}
+
+// Verifies the values recorded for the generators of a Secret template, and the data keys which store them.
+func TestGeneratedValues(t *testing.T) {
+	parse.ReplaceWithSnakeCase = true
+	chartDir := "testdata/generators"
+	scratchValuesFile, err := generateScratchValuesFile(chartDir)
+	if err != nil {
+		t.Errorf("Couldn't create the scratch file %s", scratchValuesFile)
+	}
+	defer cleanupScratchFiles([]string{scratchValuesFile})
+	parse.DefaultsFile = path.Join(chartDir, valuesFileName)
+	defer cleanupScratchFile(scratchValuesFile, parse.DefaultsFile)
+	templateFilePath := path.Join(chartDir, helmTemplatesDirectory, "Generators.yml")
+	template, err := template2.New("Generators.yml").
+		Option("missingkey=zero").
+		Funcs(template2.HelmFuncMap()).
+		ParseFiles(templateFilePath)
+	if err != nil {
+		t.Fatalf("Unexpected error while parsing %s: %s", templateFilePath, err)
+	}
+	template.Tree.Jinja2()
+	expected := []*parse.GeneratedValue{
+		{
+			Template: "Generators.yml",
+			Variable: "generated_generators_ca",
+			Function: "genCA",
+			Operands: []string{`"example-ca"`, "365"},
+			Keys:     map[string]string{"Cert": "ca.crt"},
+		},
+		{
+			Template: "Generators.yml",
+			Variable: "generated_generators_cert",
+			Function: "genSignedCert",
+			Operands: []string{".Values.tls.common_name", "nil", "[.Values.tls.common_name]", "365",
+				"generated_generators_ca"},
+			Keys: map[string]string{"Cert": "tls.crt", "Key": "tls.key"},
+		},
+		{
+			Template: "Generators.yml",
+			Variable: "generated_generators_password",
+			Function: "randAlphaNum",
+			Operands: []string{".Values.auth.password_length"},
+			Keys:     map[string]string{"": "password"},
+		},
+		{
+			Template: "Generators.yml",
+			Variable: "generated_generators_token",
+			Function: "uuidv4",
+			Operands: []string{},
+			Keys:     map[string]string{"": "token"},
+		},
+	}
+	actual := template.Tree.GeneratedValues()
+	if !reflect.DeepEqual(expected, actual) {
+		for _, value := range actual {
+			t.Logf("Generated value: %+v", *value)
+		}
+		t.Errorf("Unexpected generated values")
+	}
+}
+
+// Verifies that the use of the cluster's capabilities is recorded, so that the tasks only gather them when needed.
+func TestCapabilitiesUsed(t *testing.T) {
+	for chartDir, expected := range map[string]bool{"testdata/capabilities": true, "testdata/index": false} {
+		scratchValuesFile, err := generateScratchValuesFile(chartDir)
+		if err != nil {
+			t.Errorf("Couldn't create the scratch file %s", scratchValuesFile)
+		}
+		parse.DefaultsFile = path.Join(chartDir, valuesFileName)
+		templateFileName := strings.Title(path.Base(chartDir)) + ".yml"
+		templateFilePath := path.Join(chartDir, helmTemplatesDirectory, templateFileName)
+		template, err := template2.New(templateFileName).
+			Option("missingkey=zero").
+			Funcs(template2.HelmFuncMap()).
+			ParseFiles(templateFilePath)
+		if err != nil {
+			t.Fatalf("Unexpected error while parsing %s: %s", templateFilePath, err)
+		}
+		parse.CapabilitiesUsed = false
+		template.Tree.Jinja2()
+		if parse.CapabilitiesUsed != expected {
+			t.Errorf("Expected the use of capabilities by %s to be %t", templateFilePath, expected)
 		}
-		cleanupScratchFiles(scratchValuesFiles)
+		cleanupScratchFile(scratchValuesFile, parse.DefaultsFile)
+		cleanupScratchFiles([]string{scratchValuesFile})
 	}
 }
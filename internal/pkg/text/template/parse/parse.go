@@ -22,6 +22,18 @@ type Tree struct {
 	ParseName string    // name of the top-level template during parsing, for error messages.
 	Root      *ListNode // top-level root of the tree.
 	text      string    // text parsed to create the template (or its parent)
+	// Translation only; set while writing the Jinja2 translation.
+	callsMacros         bool                       // whether the translation invokes a template definition macro.
+	namespacedVariables map[string]bool            // variables which must be stored in a Jinja2 namespace() object.
+	generatedValues     []*GeneratedValue          // values of the generators invoked by a Secret template.
+	generatedCommands   map[Node]*GeneratedValue   // the generated value replacing each generator invocation.
+	generatedVariables  map[string]*GeneratedValue // the generated value held by each declared variable.
+	secretDataKey       string                     // the YAML key ending the text written last, naming generated values.
+	declaredVariable    string                     // the variable declared by the action being written, if any.
+	declaredCommand     Node                       // the command assigned to declaredVariable.
+	// Translation only; recorded while parsing a template definition.
+	definitionTrim BranchTrimMarkers // trim markers of the "define" or "block" and "end" actions of a definition.
+	doc            *CommentNode      // the comment immediately preceding a definition, if any.
 	// Parsing only; cleared after parse.
 	funcs     []map[string]interface{}
 	lex       *lexer
@@ -29,6 +41,7 @@ type Tree struct {
 	peekCount int
 	vars      []string // variables defined at the moment.
 	treeSet   map[string]*Tree
+	trim      TrimMarkers // trim markers of the most recently consumed delimiters.
 }
 
 // Copy returns a copy of the Tree. Any parsing state is discarded.
@@ -36,12 +49,17 @@ func (t *Tree) Copy() *Tree {
 	if t == nil {
 		return nil
 	}
-	return &Tree{
-		Name:      t.Name,
-		ParseName: t.ParseName,
-		Root:      t.Root.CopyList(),
-		text:      t.text,
+	copied := &Tree{
+		Name:           t.Name,
+		ParseName:      t.ParseName,
+		Root:           t.Root.CopyList(),
+		text:           t.text,
+		definitionTrim: t.definitionTrim,
+	}
+	if t.doc != nil {
+		copied.doc = t.doc.Copy().(*CommentNode)
 	}
+	return copied
 }
 
 // Parse returns a map from template name to parse.Tree, created by parsing the
@@ -63,6 +81,7 @@ func (t *Tree) next() item {
 	} else {
 		t.token[0] = t.lex.nextItem()
 	}
+	t.recordTrimMarker(t.token[t.peekCount])
 	return t.token[t.peekCount]
 }
 
@@ -211,6 +230,7 @@ func (t *Tree) stopParse() {
 	t.vars = nil
 	t.funcs = nil
 	t.treeSet = nil
+	t.trim = TrimMarkers{}
 }
 
 // Parse parses the template definition string to construct a representation of
@@ -246,6 +266,8 @@ func IsEmptyTree(n Node) bool {
 	case nil:
 		return true
 	case *ActionNode:
+	case *CommentNode:
+		return true
 	case *IfNode:
 	case *ListNode:
 		for _, node := range n.Nodes {
@@ -270,6 +292,7 @@ func IsEmptyTree(n Node) bool {
 // It runs to EOF.
 func (t *Tree) parse() {
 	t.Root = t.newList(t.peek().pos)
+	var doc *CommentNode // The comment documenting the next definition, if any.
 	for t.peek().typ != itemEOF {
 		if t.peek().typ == itemLeftDelim {
 			delim := t.next()
@@ -278,7 +301,10 @@ func (t *Tree) parse() {
 				newT.text = t.text
 				newT.ParseName = t.ParseName
 				newT.startParse(t.funcs, t.lex, t.treeSet)
+				newT.trim.Left = delim.trim
+				newT.doc = doc
 				newT.parseDefinition()
+				doc = nil
 				continue
 			}
 			t.backup2(delim)
@@ -286,7 +312,16 @@ func (t *Tree) parse() {
 		switch n := t.textOrAction(); n.Type() {
 		case nodeEnd, nodeElse:
 			t.errorf("unexpected %s", n)
+		case NodeComment:
+			doc = n.(*CommentNode)
+			t.Root.append(n)
+		case NodeText:
+			if !IsEmptyTree(n) {
+				doc = nil
+			}
+			t.Root.append(n)
 		default:
+			doc = nil
 			t.Root.append(n)
 		}
 	}
@@ -304,11 +339,13 @@ func (t *Tree) parseDefinition() {
 		t.error(err)
 	}
 	t.expect(itemRightDelim, context)
+	t.definitionTrim.Open = t.trim
 	var end Node
 	t.Root, end = t.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
+	t.definitionTrim.End = end.(*endNode).Trim
 	t.add()
 	t.stopParse()
 }
@@ -353,6 +390,8 @@ func (t *Tree) action() (n Node) {
 	switch token := t.nextNonSpace(); token.typ {
 	case itemBlock:
 		return t.blockControl()
+	case itemComment:
+		return t.commentControl(token)
 	case itemElse:
 		return t.elseControl()
 	case itemEnd:
@@ -369,7 +408,9 @@ func (t *Tree) action() (n Node) {
 	t.backup()
 	token := t.peek()
 	// Do not pop variables; they persist until "end".
-	return t.newAction(token.pos, token.line, t.pipeline("command"))
+	a := t.newAction(token.pos, token.line, t.pipeline("command"))
+	a.Trim = t.trim
+	return a
 }
 
 // Pipeline:
@@ -662,59 +703,71 @@ func (t *Tree) checkWithPipeline(pipe *WithPipeNode, context string) {
 	}
 }
 
-func (t *Tree) parseRangeControl(context string) (pos Pos, line int, pipe *RangePipeNode, list, elseList *ListNode) {
+func (t *Tree) parseRangeControl(context string) (pos Pos, line int, pipe *RangePipeNode, list, elseList *ListNode, trim BranchTrimMarkers) {
 	defer t.popVars(len(t.vars))
 	pipe = t.rangePipeline(context)
+	trim.Open = t.trim
 	var next Node
 	list, next = t.itemList()
 	switch next.Type() {
 	case nodeEnd: //done
 	case nodeElse:
+		trim.Else = next.(*elseNode).Trim
 		elseList, next = t.itemList()
 		if next.Type() != nodeEnd {
 			t.errorf("expected end; found %s", next)
 		}
 	}
-	return pipe.Position(), pipe.Line, pipe, list, elseList
+	trim.End = next.(*endNode).Trim
+	return pipe.Position(), pipe.Line, pipe, list, elseList, trim
 }
 
-func (t *Tree) parseWithControl(context string) (pos Pos, line int, pipe *WithPipeNode, list, elseList *ListNode) {
+func (t *Tree) parseWithControl(context string) (pos Pos, line int, pipe *WithPipeNode, list, elseList *ListNode, trim BranchTrimMarkers) {
 	defer t.popVars(len(t.vars))
 	pipe = t.withPipeline(context)
+	trim.Open = t.trim
 	var next Node
 	list, next = t.itemList()
 	switch next.Type() {
 	case nodeEnd: //done
 	case nodeElse:
+		trim.Else = next.(*elseNode).Trim
 		elseList, next = t.itemList()
 		if next.Type() != nodeEnd {
 			t.errorf("expected end; found %s", next)
 		}
 	}
-	return pipe.Position(), pipe.Line, pipe, list, elseList
+	trim.End = next.(*endNode).Trim
+	return pipe.Position(), pipe.Line, pipe, list, elseList, trim
 }
 
-func (t *Tree) parseIfControl(context string) (pos Pos, line int, pipe *IfPipeNode, list, elseList *ListNode) {
+func (t *Tree) parseIfControl(context string) (pos Pos, line int, pipe *IfPipeNode, list, elseList *ListNode, trim BranchTrimMarkers) {
 	defer t.popVars(len(t.vars))
 	pipe = t.ifPipeline(context)
+	trim.Open = t.trim
 	var next Node
 	list, next = t.itemList()
 	switch next.Type() {
 	case nodeEnd: //done
 	case nodeElse:
+		trim.Else = next.(*elseNode).Trim
 		if t.peek().typ == itemIf {
 			t.next() // Consume the "if" token.
 			elseList = t.newList(next.Position())
-			elseList.append(t.ifControl())
-			// Do not consume the next item - only one {{end}} required.
-			break
+			elseIf := t.newIfControl(t.parseIfControl("if"))
+			elseIf.IsElseIf = true
+			elseList.append(elseIf)
+			// Do not consume the next item - only one {{end}} required.  The "end" closes the whole chain.
+			trim.End = elseIf.Trim.End
+			return pipe.Position(), pipe.Line, pipe, list, elseList, trim
 		}
 		elseList, next = t.itemList()
 		if next.Type() != nodeEnd {
 			t.errorf("expected end; found %s", next)
 		}
 	}
-	return pipe.Position(), pipe.Line, pipe, list, elseList
+	trim.End = next.(*endNode).Trim
+	return pipe.Position(), pipe.Line, pipe, list, elseList, trim
 }
 
 // If:
@@ -722,7 +775,14 @@ func (t *Tree) parseIfControl(context string) (pos Pos, line int, pipe *IfPipeNo
 //	{{if pipeline}} itemList {{else}} itemList {{end}}
 // If keyword is past.
 func (t *Tree) ifControl() Node {
-	return t.newIf(t.parseIfControl("if"))
+	return t.newIfControl(t.parseIfControl("if"))
+}
+
+// newIfControl builds an IfNode from the result of parseIfControl.
+func (t *Tree) newIfControl(pos Pos, line int, pipe *IfPipeNode, list, elseList *ListNode, trim BranchTrimMarkers) *IfNode {
+	n := t.newIf(pos, line, pipe, list, elseList)
+	n.Trim = trim
+	return n
 }
 
 // Range:
@@ -730,7 +790,10 @@ func (t *Tree) ifControl() Node {
 //	{{range pipeline}} itemList {{else}} itemList {{end}}
 // Range keyword is past.
 func (t *Tree) rangeControl() Node {
-	return t.newRange(t.parseRangeControl("range"))
+	pos, line, pipe, list, elseList, trim := t.parseRangeControl("range")
+	n := t.newRange(pos, line, pipe, list, elseList)
+	n.Trim = trim
+	return n
 }
 
 // With:
@@ -738,14 +801,29 @@ func (t *Tree) rangeControl() Node {
 //	{{with pipeline}} itemList {{else}} itemList {{end}}
 // If keyword is past.
 func (t *Tree) withControl() Node {
-	return t.newWith(t.parseWithControl("with"))
+	pos, line, pipe, list, elseList, trim := t.parseWithControl("with")
+	n := t.newWith(pos, line, pipe, list, elseList)
+	n.Trim = trim
+	return n
+}
+
+// Comment:
+//	{{/* comment */}}
+// Comment text is past.
+func (t *Tree) commentControl(token item) Node {
+	t.expect(itemRightDelim, "comment")
+	c := t.newComment(token.pos, token.val)
+	c.Trim = t.trim
+	return c
 }
 
 // End:
 //	{{end}}
 // End keyword is past.
 func (t *Tree) endControl() Node {
-	return t.newEnd(t.expect(itemRightDelim, "end").pos)
+	e := t.newEnd(t.expect(itemRightDelim, "end").pos)
+	e.Trim = t.trim
+	return e
 }
 
 // Else:
@@ -755,11 +833,15 @@ func (t *Tree) elseControl() Node {
 	// Special case for "else if".
 	peek := t.peekNonSpace()
 	if peek.typ == itemIf {
-		// We see "{{else if ... " but in effect rewrite it to {{else}}{{if ... ".
-		return t.newElse(peek.pos, peek.line)
+		// We see "{{else if ... " but in effect rewrite it to {{else}}{{if ... ".  The right delimiter belongs to the "if".
+		e := t.newElse(peek.pos, peek.line)
+		e.Trim = TrimMarkers{Left: t.trim.Left}
+		return e
 	}
 	token := t.expect(itemRightDelim, "else")
-	return t.newElse(token.pos, token.line)
+	e := t.newElse(token.pos, token.line)
+	e.Trim = t.trim
+	return e
 }
 
 // Block:
@@ -773,20 +855,25 @@ func (t *Tree) blockControl() Node {
 	token := t.nextNonSpace()
 	name := t.parseTemplateName(token, context)
 	pipe := t.pipeline(context)
+	trim := t.trim
 
 	block := New(name) // name will be updated once we know it.
 	block.text = t.text
 	block.ParseName = t.ParseName
 	block.startParse(t.funcs, t.lex, t.treeSet)
+	block.definitionTrim.Open = trim
 	var end Node
 	block.Root, end = block.itemList()
 	if end.Type() != nodeEnd {
 		t.errorf("unexpected %s in %s", end, context)
 	}
+	block.definitionTrim.End = end.(*endNode).Trim
 	block.add()
 	block.stopParse()
 
-	return t.newTemplate(token.pos, token.line, name, pipe)
+	n := t.newTemplate(token.pos, token.line, name, pipe)
+	n.Trim = trim
+	return n
 }
 
 // Template:
@@ -803,7 +890,9 @@ func (t *Tree) templateControl() Node {
 		// Do not pop variables; they persist until "end".
 		pipe = t.pipeline(context)
 	}
-	return t.newTemplate(token.pos, token.line, name, pipe)
+	n := t.newTemplate(token.pos, token.line, name, pipe)
+	n.Trim = t.trim
+	return n
 }
 
 func (t *Tree) parseTemplateName(token item, context string) (name string) {
@@ -914,7 +1003,8 @@ func (t *Tree) operand() Node {
 		case NodeField:
 			node = t.newField(chain.Position(), chain.String())
 		case NodeVariable:
-			node = t.newVariable(chain.Position(), chain.String())
+			// The chain is joined directly, since the Jinja2 translation of a variable drops the "$" prefix.
+			node = t.newVariable(chain.Position(), strings.Join(append(node.(*VariableNode).Ident, chain.Field...), "."))
 		case NodeBool, NodeString, NodeNumber, NodeNil, NodeDot:
 			t.errorf("unexpected . after term %q", node.String())
 		default:
@@ -948,7 +1038,8 @@ func (t *Tree) ifOperand() Node {
 		case NodeField:
 			node = t.newField(chain.Position(), chain.String())
 		case NodeVariable:
-			node = t.newVariable(chain.Position(), chain.String())
+			// The chain is joined directly, since the Jinja2 translation of a variable drops the "$" prefix.
+			node = t.newVariable(chain.Position(), strings.Join(append(node.(*VariableNode).Ident, chain.Field...), "."))
 		case NodeBool, NodeString, NodeNumber, NodeNil, NodeDot:
 			t.errorf("unexpected . after term %q", node.String())
 		default:
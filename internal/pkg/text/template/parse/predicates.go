@@ -0,0 +1,60 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"strconv"
+)
+
+// Sprig's string and type predicates have no Ansible filters, but correspond to Jinja2 string methods and tests:
+//
+// hasPrefix p s           ->  (s | string).startswith(p)
+// hasSuffix p s           ->  (s | string).endswith(p)
+// typeIs "string" v       ->  v is string
+// kindIs "map" v          ->  v is mapping
+// kindIs "slice" v        ->  (v is sequence and v is not string and v is not mapping)
+//
+// Only the types which the Jinja2 tests distinguish are translated;  other types, or a type which isn't a literal, are
+// piped into the filter plugin of the same name (see shim), which must be provided.
+
+// kindTests maps the kinds reported by "kindOf" to the equivalent Jinja2 tests, written with "$1" as the subject.
+var kindTests = map[string]string{
+	"map":    "$1 is mapping",
+	"slice":  "($1 is sequence and $1 is not string and $1 is not mapping)",
+	"string": "$1 is string",
+}
+
+// typeTests maps the types reported by "typeOf" for chart values to the equivalent Jinja2 tests, like kindTests.
+var typeTests = map[string]string{
+	"[]interface {}":          kindTests["slice"],
+	"map[string]interface {}": kindTests["map"],
+	"string":                  kindTests["string"],
+}
+
+// Returns the writer of a predicate which invokes a Python string method on its last operand.
+func stringMethod(method string) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) != 2 {
+			return nil
+		}
+		expression := "(" + operands[1] + " | string)." + method + "(" + operands[0] + ")"
+		return &expression
+	}
+}
+
+// Returns the writer of a type predicate, which translates the literal types found in tests.
+func typeTest(function string, tests map[string]string) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) != 2 {
+			return nil
+		}
+		name, err := strconv.Unquote(operands[0])
+		test, ok := tests[name]
+		if err != nil || !ok {
+			logrus.Warnf("Function \"%s\" has no Jinja2 test for type %s, and was piped into the \"%s\" filter plugin",
+				function, operands[0], function)
+			return shim(function).translate(operands)
+		}
+		expression := expandArgumentReferences(test, []string{parenthesizeTerm(operands[1])})
+		return &expression
+	}
+}
@@ -3,6 +3,8 @@ package parse
 import (
 	"github.com/redhat-nfvpe/helm-ansible-template-exporter/internal/pkg/helm"
 	"github.com/sirupsen/logrus"
+	"reflect"
+	"strconv"
 	"strings"
 )
 
@@ -27,7 +29,21 @@ import (
 //
 // The translation is:
 //
-// {% for key, value in someDict.iterItems() %}
+// {% for var_key, var_value in someDict | dictsort(true) %}
+//
+// Go ranges over the entries of a map in the order of their keys, whereas a Jinja2 dictionary and its items() iterate
+// in insertion order.  The items are therefore sorted by key, case-sensitively like Go.  Declaring a single variable,
+// or none, ranges over the values of a map, which is written as "someDict | dictsort(true) | map('last')" when the
+// chart's values hold a dictionary;  lists, including lists of maps, are iterated as is.
+//
+// Declaring two variables over a list, or over a list constructed by a function such as "until", assigns the index and
+// the value of each element instead.  The index is assigned from the loop:
+//
+// {{ range $i, $host := hosts }}
+//
+// The translation is:
+//
+// {% for var_host in hosts %}{% set var_i = loop.index0 %}
 //
 // Lastly, in the case of list-range input, Go Template language implies an iterator.  That is, you can access
 // properties of the list using the member access operator ".".  For example:
@@ -36,7 +52,9 @@ import (
 // {{ .ipAddress }}
 // {{ end }}
 //
-// The RangeNode implementation addresses this by appending the iterator variable name.  The translation is:
+// The RangeNode implementation addresses this by binding "." to the loop variable while the body is written, so every
+// "." and ".field" reference resolves to it, however deeply "range" and "with" blocks are nested.  The loop variable
+// is the value variable if one is declared, and is otherwise derived from the collection.  The translation is:
 //
 // {% for item_computerList in computerList %}
 // {{ item_computerList.ipAddress }}
@@ -45,10 +63,11 @@ type RangeNode struct {
 	NodeType
 	Pos
 	tr       *Tree
-	Line     int            // The line number in the input. Deprecated: Kept for compatibility.
-	Pipe     *RangePipeNode // The pipeline to be evaluated.
-	List     *ListNode      // What to execute if the value is non-empty.
-	ElseList *ListNode      // What to execute if the value is empty (nil if absent).
+	Line     int               // The line number in the input. Deprecated: Kept for compatibility.
+	Pipe     *RangePipeNode    // The pipeline to be evaluated.
+	List     *ListNode         // What to execute if the value is non-empty.
+	ElseList *ListNode         // What to execute if the value is empty (nil if absent).
+	Trim     BranchTrimMarkers // The trim markers of the "range", "else" and "end" actions.
 }
 
 func (t *Tree) newRange(pos Pos, line int, pipe *RangePipeNode, list, elseList *ListNode) *RangeNode {
@@ -61,28 +80,53 @@ func (r *RangeNode) String() string {
 	return sb.String()
 }
 
-func (r *RangeNode) RemoveVarPrefix(prefix string) {
-	for _, v := range r.Pipe.Decl {
-		for i := range v.Ident {
-			v.Ident[i] = strings.TrimPrefix(v.Ident[i], prefix)
-		}
-	}
-}
-
 // GetRangeUseCaseType ... get difference cases for range flow
 func (r *RangeNode) GetRangeUseCaseType() RangeUseCaseType {
-	if len(r.Pipe.Decl) == 0 && len(r.Pipe.Cmds[0].Args) == 1 {
+	if len(r.Pipe.Decl) == 0 && isFunctionInvocation(r.Pipe.Cmds[0].Args) {
+		return UseCaseTuple
+	} else if len(r.Pipe.Decl) == 0 && len(r.Pipe.Cmds[0].Args) == 1 {
 		return UseCaseNoVariables
 	} else if len(r.Pipe.Decl) == 2 { //key value
 		return UseCaseKeyValue
 	} else if len(r.Pipe.Decl) == 1 && len(r.Pipe.Cmds[0].Args) == 1 { //$host and one value
 		return UseCaseSingleValue
-	} else if len(r.Pipe.Decl) == 0 && len(r.Pipe.Cmds[0].Args) == 1 && r.Pipe.Cmds[0].Args[0].String() == "tuple" {
-		return UseCaseTuple
 	}
 	return UseCaseDefault
 }
 
+// Determines the kind of the collection ranged over, such as reflect.Map, by consulting the chart's values.  Returns
+// reflect.Invalid if the collection isn't a value of the chart.
+func (r *RangeNode) collectionKind() reflect.Kind {
+	if len(r.Pipe.Cmds) != 1 || len(r.Pipe.Cmds[0].Args) != 1 || !isValueNode(r.Pipe.Cmds[0].Args[0].String()) {
+		return reflect.Invalid
+	}
+	collection := r.Pipe.Cmds[0].Args[0].String()
+	kind, err := helm.GetValueKind(collection)
+	if err != nil {
+		logrus.Infof("Couldn't determine the kind of %s at position %d from Helm chart's values: %s", collection, r.Pos,
+			err)
+	}
+	return kind
+}
+
+// Determines whether the collection ranged over is a list, either because the chart's values hold a list or because it
+// is constructed by a function returning a list, such as "until".
+func (r *RangeNode) isListRange() bool {
+	if function, ok := r.Pipe.Cmds[len(r.Pipe.Cmds)-1].Args[0].(*IdentifierNode); ok {
+		return listFunctions[function.Ident]
+	}
+	return r.collectionKind() == reflect.Slice
+}
+
+// Determines whether the arguments of a command invoke a function, such as "tuple", which constructs the collection.
+func isFunctionInvocation(args []Node) bool {
+	if len(args) < 2 {
+		return false
+	}
+	_, ok := args[0].(*IdentifierNode)
+	return ok
+}
+
 // RangeUseCaseType identifies the types of uses cases for range.
 type RangeUseCaseType int
 
@@ -91,12 +135,14 @@ type RangeUseCaseType int
    --------------------------------------------------------------------------------------------------------
   | *{{- range .Values.ingress.secrets }}   |       0 & 1          | {% for item_secrets in .Values.ingress.secrets }} |
   ----------------------------------------------------------------------------------------------------------
-  | {{range $key, $value := ingress.annotations }}  | 2 & 1 | {% for $key, $value in ingress.annotations %}|
+  | {{range $key, $value := ingress.annotations }}  | 2 & 1 | {% for var_key, var_value in ingress.annotations | dictsort(true) %}|
   -----------------------------------------------------------------------------------------------------------
-  | {{- range $host := .Values.ingress.hosts }}  | 1 & 1 | {% for $host in .Values.ingress.hosts }}        |
+  | {{range $i, $host := .Values.ingress.hosts }}  | 2 & 1 | {% for var_host in .Values.ingress.hosts %}{% set var_i = loop.index0 %}|
+  -----------------------------------------------------------------------------------------------------------
+  | {{- range $host := .Values.ingress.hosts }}  | 1 & 1 | {% for var_host in .Values.ingress.hosts }}    |
   ----------------------------------------------------------------------------------------------------------
   | {{ range tuple "config1.toml" "config2.toml" "config3.toml" }} |0 & n |
-  								{% for tuple "config1.toml" "config2.toml" "config3.toml" %}
+  								{% for item in ["config1.toml", "config2.toml", "config3.toml"] %}
 */
 const (
 	UseCaseDefault     RangeUseCaseType = iota //Unknown use cases
@@ -106,31 +152,71 @@ const (
 	UseCaseTuple                               //range tuple "config1.toml" "config2.toml" "config3.toml" }}
 )
 
+// dictSortFilter sorts the items of a dictionary by key, in the order Go ranges over a map.
+const dictSortFilter = "dictsort(true)"
+
+// dictValuesFilter lists the values of a dictionary, in the order Go ranges over a map.
+const dictValuesFilter = dictSortFilter + " | map('last')"
+
+// loopIndexVariable holds the index of the current iteration of a Jinja2 loop, counting from zero like Go.
+const loopIndexVariable = "loop.index0"
+
+// listFunctions lists the functions which construct a list, over which a range declaring two variables assigns the
+// index and value of each element rather than a key and value.
+var listFunctions = map[string]bool{
+	"append":    true,
+	"compact":   true,
+	"concat":    true,
+	"keys":      true,
+	"list":      true,
+	"prepend":   true,
+	"reverse":   true,
+	"sortAlpha": true,
+	"splitList": true,
+	"tuple":     true,
+	"uniq":      true,
+	"until":     true,
+	"untilStep": true,
+	"without":   true,
+}
+
+// Derives the name of the loop variable "." is bound to, appending the nesting depth if an enclosing scope is already
+// bound to the same name, like WithNode.alias.
+func loopItem(name string) string {
+	for _, s := range scopes {
+		if s.dot == name {
+			return name + "_" + strconv.Itoa(len(scopes))
+		}
+	}
+	return name
+}
+
+// tupleItem is the loop variable of a range over a collection constructed by a function, such as "tuple".
+const tupleItem = "item"
+
 func (r *RangeNode) writeTo(sb *strings.Builder) {
-	var rangeValues *map[string][]*helm.LogHelmReport
-	var dotValue = make(map[string][]*helm.LogHelmReport)
-	dotValue["."] = []*helm.LogHelmReport{}
-	var itemField string
-	removeBodyVariablePrefix := false
+	var item string
+	var indexVariable string
 
-	sb.WriteString("{% ")
+	r.Trim.Open.writeLeftTo(sb, statementLeftDelim)
 	/*-------------------------------------------------------------------------------------------------------
 	  | INPUT                                  | LHS(vars) & RHS(cmds) |  OUTPUT                              |
 	   --------------------------------------------------------------------------------------------------------
 	  | *{{- range .Values.ingress.secrets }}   |       0 & 1          | {% for item_secrets in .Values.ingress.secrets }} |
 	  ----------------------------------------------------------------------------------------------------------
-	  | {{range $key, $value := ingress.annotations }}  | 2 & 1 | {% for $key, $value in ingress.annotations %}|
+	  | {{range $key, $value := ingress.annotations }}  | 2 & 1 | {% for var_key, var_value in ingress.annotations | dictsort(true) %}|
+	  -----------------------------------------------------------------------------------------------------------
+	  | {{range $i, $host := .Values.ingress.hosts }}  | 2 & 1 | {% for var_host in .Values.ingress.hosts %}{% set var_i = loop.index0 %}|
 	  -----------------------------------------------------------------------------------------------------------
-	  | {{- range $host := .Values.ingress.hosts }}  | 1 & 1 | {% for $host in .Values.ingress.hosts }}        |
+	  | {{- range $host := .Values.ingress.hosts }}  | 1 & 1 | {% for var_host in .Values.ingress.hosts }}    |
 	  ----------------------------------------------------------------------------------------------------------
 	  | {{ range tuple "config1.toml" "config2.toml" "config3.toml" }} |0 & n |
-									{% for tuple "config1.toml" "config2.toml" "config3.toml" %}
+									{% for item in ["config1.toml", "config2.toml", "config3.toml"] %}
 	*/
 	//a) if you have zero variables and one command argument then {{- range .Values.ingress.secrets }}
-	////1. derive the item_name and prefix the variables under the cmds variable found  in values with $item_name
-	//r) if you have two variables then assume  you have key and value don't have to do anything
-	//c) if you have  one variable then
-	// 1. derive the item_name and prefix the variables under the cmds variable found  in values with $item_name
+	////1. derive the item_name, which dot refers to within the loop
+	//r) if you have two variables then assume  you have key and value, unless ranging over a list, which assigns the index
+	//c) if you have  one variable then dot refers to the variable within the loop
 	switch r.GetRangeUseCaseType() {
 	case UseCaseNoVariables:
 		{ //{{- range .Values.ingress.secrets }}
@@ -138,71 +224,83 @@ func (r *RangeNode) writeTo(sb *strings.Builder) {
 			sb.WriteString("for")
 			sb.WriteByte(' ')
 			ss := strings.Split(r.Pipe.Cmds[0].Args[0].String(), ".")
-			itemField = "item_" + ss[len(ss)-1]
-			sb.WriteString(itemField)
+			item = loopItem("item_" + ss[len(ss)-1])
+			sb.WriteString(item)
 			sb.WriteByte(' ')
 			sb.WriteString("in")
 			sb.WriteByte(' ')
-			r.Pipe.writeForTo(sb)
-			rangeValues, _ = helm.GetValues(r.Pipe.Cmds[0].Args[0].String())
-			logrus.Info("Attempting to prefix variables with loop variable,example: `value` becomes `item.value` for template", r.tr.Name)
-			//attempting for dot values
-			if rangeValues == nil {
-				logrus.Warnf("Failed to prefix variables with loop variable value for template %s", r.tr.Name)
-				logrus.Warnf("%s at position %d was not found in Helm chart's values: invalid path", r.Pipe.Cmds[0].Args[0].String(), r.Pos)
-				rangeValues = &dotValue
+			if r.collectionKind() == reflect.Map {
+				r.Pipe.writeForTo(sb, dictValuesFilter)
 			} else {
-				(*rangeValues)["."] = []*helm.LogHelmReport{}
+				r.Pipe.writeForTo(sb, "")
 			}
-
 		}
-	case UseCaseKeyValue, UseCaseSingleValue:
-		{
+	case UseCaseKeyValue:
+		{ //{{- range $key, $value := .Values.ingress.annotations }}
+			sb.WriteString("for")
+			sb.WriteByte(' ')
+			if r.isListRange() {
+				//{{- range $index, $host := .Values.ingress.hosts }} declares the index of each value
+				r.Pipe.writeValueForTo(sb)
+				indexVariable = r.Pipe.Decl[0].String()
+			} else {
+				r.Pipe.writeForTo(sb, dictSortFilter)
+			}
+		}
+	case UseCaseSingleValue:
+		{ //{{- range $host := .Values.ingress.hosts }}
 			sb.WriteString("for")
 			sb.WriteByte(' ')
-			r.RemoveVarPrefix("$")
-			r.Pipe.writeForTo(sb)
-			removeBodyVariablePrefix = true
+			if r.collectionKind() == reflect.Map {
+				r.Pipe.writeForTo(sb, dictValuesFilter)
+			} else {
+				r.Pipe.writeForTo(sb, "")
+			}
 		}
 	case UseCaseTuple:
-		{
+		{ //{{ range tuple "config1.toml" "config2.toml" }}
+			//the constructed collection has no name to derive the item from, so dot refers to "item" within the loop
 			sb.WriteString("for")
 			sb.WriteByte(' ')
-			r.Pipe.writeForTo(sb)
+			item = loopItem(tupleItem)
+			sb.WriteString(item)
+			sb.WriteString(" in ")
+			r.Pipe.writeForTo(sb, "")
 		}
 	default:
 		{
 			sb.WriteString("for ")
-			r.Pipe.writeForTo(sb)
+			r.Pipe.writeForTo(sb, "")
 		}
 	}
 
-	sb.WriteString(" %}")
-	r.List.writeTo(sb)
-	// all the things if the conditional is true
-	//prefix  range variables with item
-	if rangeValues != nil {
-		helm.PreFixValuesWithItems(sb, itemField, rangeValues)
-		logrus.Infof("**************************************************************")
-		logrus.Info("       for loop variables replacement inside for loop : 	", r.tr.Name)
-		logrus.Infof("**************************************************************")
-		logrus.Infof("For loop: Following variables were prefixed with %s in template %s", itemField, r.tr.Name)
-		for k, v := range *rangeValues {
-			helm.PrintReportItems(v)
-			delete(*rangeValues, k)
-		}
-		logrus.Infof("**************************************************************")
+	r.Trim.Open.writeRightTo(sb, statementRightDelim)
+	if indexVariable != "" {
+		// the statement writes no text, so the trim marker of the "range" action carries over to the text following it
+		TrimMarkers{Right: r.Trim.Open.Right}.writeStatementTo(sb, "set "+indexVariable+" = "+loopIndexVariable)
 	}
-	// Clean $ prefixed variable
-	if removeBodyVariablePrefix {
-		helm.RemoveDollarPrefix(sb)
+	if item == "" && len(r.Pipe.Decl) > 0 {
+		item = r.Pipe.Decl[len(r.Pipe.Decl)-1].String()
+	}
+	if item != "" {
+		logrus.Infof("\"range\" block on line %d bound to loop variable: %s", r.Line, item)
+		pushScope(scope{dot: item, values: r.isValuesRange()})
+		r.List.writeTo(sb)
+		popScope()
+	} else {
+		r.List.writeTo(sb)
 	}
-
 	if r.ElseList != nil {
-		sb.WriteString("{% else %}")
+		r.Trim.Else.writeStatementTo(sb, "else")
 		r.ElseList.writeTo(sb)
 	}
-	sb.WriteString("{% endfor %}")
+	r.Trim.End.writeStatementTo(sb, "endfor")
+}
+
+// Determines whether the range iterates the chart's values, such as ".Values.servers", whose nested keys are converted
+// to snake_case along with the defaults.
+func (r *RangeNode) isValuesRange() bool {
+	return len(r.Pipe.Cmds) == 1 && len(r.Pipe.Cmds[0].Args) == 1 && isValuesReference(r.Pipe.Cmds[0].Args[0])
 }
 
 func (r *RangeNode) tree() *Tree {
@@ -210,5 +308,7 @@ func (r *RangeNode) tree() *Tree {
 }
 
 func (r *RangeNode) Copy() Node {
-	return r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	copied := r.tr.newRange(r.Pos, r.Line, r.Pipe.CopyPipe(), r.List.CopyList(), r.ElseList.CopyList())
+	copied.Trim = r.Trim
+	return copied
 }
\ No newline at end of file
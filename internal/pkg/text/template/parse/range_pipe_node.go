@@ -39,12 +39,7 @@ func (p *RangePipeNode) writeTo(sb *strings.Builder) {
 		}
 		sb.WriteString(" := ")
 	}
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.writeTo(sb)
-	}
+	writePipelineTo(sb, commandNodes(p.Cmds))
 }
 
 func (p *RangePipeNode) tree() *Tree {
@@ -71,8 +66,8 @@ func (p *RangePipeNode) Copy() Node {
 	return p.CopyPipe()
 }
 
-// writeFor is used used to convert `:=` to `in`
-func (p *RangePipeNode) writeForTo(sb *strings.Builder) {
+// writeFor is used used to convert `:=` to `in`.  The filter, if any, is applied to the collection, such as "dictsort".
+func (p *RangePipeNode) writeForTo(sb *strings.Builder, filter string) {
 	if len(p.Decl) > 0 {
 		for i, v := range p.Decl {
 			if i > 0 {
@@ -82,10 +77,21 @@ func (p *RangePipeNode) writeForTo(sb *strings.Builder) {
 		}
 		sb.WriteString(" in ")
 	}
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.writeTo(sb)
+	if filter == "" {
+		writePipelineTo(sb, commandNodes(p.Cmds))
+		return
 	}
+	var collection strings.Builder
+	writePipelineTo(&collection, commandNodes(p.Cmds))
+	sb.WriteString(parenthesize(collection.String()))
+	sb.WriteString(" | ")
+	sb.WriteString(filter)
+}
+
+// writeValueForTo is used to convert `$index, $value :=` to `value in`, ranging over the values of a list;  the index
+// is assigned separately.
+func (p *RangePipeNode) writeValueForTo(sb *strings.Builder) {
+	p.Decl[len(p.Decl)-1].writeTo(sb)
+	sb.WriteString(" in ")
+	writePipelineTo(sb, commandNodes(p.Cmds))
 }
@@ -0,0 +1,111 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+// Sprig's regular expression replacements map onto Ansible's "regex_replace" filter, but the syntax of the replacement
+// differs.  Go expands "$1", "${1}" and "${name}" and escapes a dollar sign as "$$", whereas Python expands "\1" and
+// "\g<name>" and escapes a backslash:
+//
+// regexReplaceAll "(a+)b" s "${1}c"          ->  s | regex_replace('(a+)b', '\\g<1>c')
+// regexReplaceAllLiteral "a+" s "$1\\"       ->  s | regex_replace('a+', '$1\\\\')
+//
+// Literal replacements are converted;  replacements computed by the template are passed on as is, and flagged.  Sprig's
+// "trimAll" removes a set of characters from both ends of a string, which is written as an anchored "regex_replace",
+// since the "trim" filter only accepts characters from Jinja2 3.0 on:
+//
+// trimAll "-_" s  ->  s | regex_replace('^[\\-_]+|[\\-_]+$', '')
+
+// Returns the writer of a regular expression replacement, which converts a literal replacement to Python's syntax.
+func regexReplacement(function string, convert func(replacement string) string) func(operands []string) *string {
+	return func(operands []string) *string {
+		if len(operands) != 3 {
+			return nil
+		}
+		replacement := operands[2]
+		if literal, err := strconv.Unquote(replacement); err == nil {
+			replacement = jinja2String(convert(literal))
+		} else {
+			logrus.Warnf("Replacement %s of function \"%s\" isn't a literal, and is passed to \"regex_replace\" as is;  "+
+				"Python expands \"\\1\" rather than \"$1\"", replacement, function)
+		}
+		expression := parenthesize(operands[1]) + " | regex_replace(" + operands[0] + ", " + replacement + ")"
+		return &expression
+	}
+}
+
+// Converts a Go replacement template, such as "${1}c", into a Python replacement, such as "\g<1>c".
+func expandedReplacement(replacement string) string {
+	var sb strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		c := replacement[i]
+		switch {
+		case c == '\\':
+			sb.WriteString(`\\`)
+		case c != '$' || i+1 == len(replacement):
+			sb.WriteByte(c)
+		case replacement[i+1] == '$':
+			sb.WriteByte('$')
+			i++
+		case replacement[i+1] == '{':
+			end := strings.IndexByte(replacement[i:], '}')
+			if end < 0 {
+				sb.WriteByte(c)
+				continue
+			}
+			sb.WriteString(`\g<` + replacement[i+2:i+end] + `>`)
+			i += end
+		default:
+			// Go takes the longest sequence of letters, digits and underscores as the name of the group.
+			end := i + 1
+			for end < len(replacement) && isGroupNameCharacter(replacement[end]) {
+				end++
+			}
+			if end == i+1 {
+				sb.WriteByte(c)
+				continue
+			}
+			sb.WriteString(`\g<` + replacement[i+1:end] + `>`)
+			i = end - 1
+		}
+	}
+	return sb.String()
+}
+
+// Converts a literal Go replacement into a Python replacement, in which only backslashes are special.
+func literalReplacement(replacement string) string {
+	return strings.ReplaceAll(replacement, `\`, `\\`)
+}
+
+func isGroupNameCharacter(c byte) bool {
+	return c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Writes "trimAll" as an anchored "regex_replace" of a character class.  Characters which aren't a literal are escaped
+// by the "regex_escape" filter.
+func translateTrimAll(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	var pattern string
+	if literal, err := strconv.Unquote(operands[0]); err == nil {
+		if literal == "" {
+			return &operands[1]
+		}
+		class := "[" + escapeCharacterClass(literal) + "]+"
+		pattern = jinja2String("^" + class + "|" + class + "$")
+	} else {
+		characters := "(" + operands[0] + " | regex_escape)"
+		pattern = "'^[' ~ " + characters + " ~ ']+|[' ~ " + characters + " ~ ']+$'"
+	}
+	expression := parenthesize(operands[1]) + " | regex_replace(" + pattern + ", '')"
+	return &expression
+}
+
+// Escapes the characters which are special within a regular expression character class.
+func escapeCharacterClass(characters string) string {
+	return strings.NewReplacer(`\`, `\\`, `]`, `\]`, `[`, `\[`, `^`, `\^`, `-`, `\-`).Replace(characters)
+}
@@ -0,0 +1,37 @@
+package parse
+
+// Helm's "lookup" function fetches a resource from the cluster, and is commonly used to keep generated values, such as
+// passwords, stable across upgrades:
+//
+// {{- $secret := lookup "v1" "Secret" .Release.Namespace "credentials" }}
+//
+// Ansible provides the same query through the "kubernetes.core.k8s" lookup plugin, so the invocation becomes:
+//
+// {%- set var_secret = query('kubernetes.core.k8s', api_version="v1", kind="Secret", namespace=release_namespace,
+//                            resource_name="credentials") | first | default({}) %}
+//
+// "lookup" returns an empty dictionary when the resource isn't found, which "first" and "default" reproduce.  An empty
+// name lists the resources instead, which Helm returns as a dictionary holding the "items", and an empty namespace
+// queries all namespaces (or a cluster scoped resource).
+
+const k8sLookupPlugin = "kubernetes.core.k8s"
+
+// Go's empty string literal, which Helm interprets as "any" for the namespace and name of a lookup.
+const emptyStringLiteral = `""`
+
+func translateLookup(operands []string) *string {
+	if len(operands) != 4 {
+		return nil
+	}
+	apiVersion, kind, namespace, name := operands[0], operands[1], operands[2], operands[3]
+	query := "query('" + k8sLookupPlugin + "', api_version=" + apiVersion + ", kind=" + kind
+	if namespace != emptyStringLiteral {
+		query += ", namespace=" + namespace
+	}
+	if name == emptyStringLiteral {
+		expression := "{'items': " + query + ")}"
+		return &expression
+	}
+	expression := query + ", resource_name=" + name + ") | first | default({})"
+	return &expression
+}
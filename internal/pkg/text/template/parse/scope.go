@@ -0,0 +1,176 @@
+package parse
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// Go templates implicitly rebind the cursor (".") when entering a template definition or the body of a "range" or
+// "with"; Jinja2 has no such concept, so the rebinding must be made explicit in the translation.  The scope stack
+// tracks what "." refers to while a tree is being written, and the writers for DotNode and FieldNode consult the
+// innermost scope to decide how to emit "." and ".field" references.  Scopes are pushed and popped while writing, so the stack is always empty between translations.
+
+// helmBuiltinObjects are the top-level objects Helm injects into the root context of every template.  References to
+// them (i.e., ".Values.replicaCount") are left global, even when "." has been rebound, since Helm helpers almost always
+// receive the root context and the exporter translates these objects globally.
+var helmBuiltinObjects = map[string]bool{
+	"Values":       true,
+	"Release":      true,
+	"Chart":        true,
+	"Capabilities": true,
+	"Template":     true,
+	"Files":        true,
+}
+
+// scope represents a single rebinding of ".".
+type scope struct {
+	dot    string // The Jinja2 expression "." refers to.  Empty when "." is the template root.
+	macro  bool   // Whether the scope is the body of a template definition (a Jinja2 macro).
+	values bool   // Whether "." is bound to the chart's values, whose keys are converted along with the defaults.
+}
+
+var scopes []scope
+
+func pushScope(s scope) {
+	scopes = append(scopes, s)
+}
+
+func popScope() {
+	scopes = scopes[:len(scopes)-1]
+}
+
+// The innermost scope;  the zero scope represents the template root.
+func currentScope() scope {
+	if len(scopes) == 0 {
+		return scope{}
+	}
+	return scopes[len(scopes)-1]
+}
+
+// The scope "$" refers to;  the body of the enclosing template definition, or the template root.
+func rootScope() scope {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i].macro {
+			return scopes[i]
+		}
+	}
+	return scope{}
+}
+
+// Whether the tree currently being written is the body of a template definition.
+func inMacro() bool {
+	for _, s := range scopes {
+		if s.macro {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether a Jinja2 variable, such as a loop variable or a "with" alias, is bound to the chart's values by an enclosing
+// scope.
+func isValuesVariable(name string) bool {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if scopes[i].dot == name {
+			return scopes[i].values
+		}
+	}
+	return false
+}
+
+// Determines whether a node refers to the chart's values, or to a value nested within them, such as
+// ".Values.ingress", "$.Values.ingress" or ".hosts" while "." is bound to ".Values.ingress".  The keys of the values
+// are converted to snake_case in the defaults when ReplaceWithSnakeCase is set, so references through such a scope
+// are converted as well.
+func isValuesReference(node Node) bool {
+	switch n := node.(type) {
+	case *DotNode:
+		return currentScope().values
+	case *FieldNode:
+		if i := rootContextArgumentReference(n.Ident); i > 0 {
+			return "."+n.Ident[i] == valuesPrefix
+		}
+		if isHelmBuiltinObjectReference(n.Ident) {
+			return "."+n.Ident[0] == valuesPrefix
+		}
+		return currentScope().values
+	case *VariableNode:
+		if n.Ident[0] == goVariablePrefix {
+			return len(n.Ident) > 1 && "."+n.Ident[1] == valuesPrefix
+		}
+		return isValuesVariable(variableName(n.Ident[0]))
+	case *ChainNode:
+		return n.Node.String() == valuesPrefix
+	}
+	return false
+}
+
+// Whether a field reference is rooted at a Helm builtin object, such as ".Values" or ".Release".
+func isHelmBuiltinObjectReference(ident []string) bool {
+	return len(ident) > 0 && helmBuiltinObjects[ident[0]]
+}
+
+// Returns the position of the Helm builtin object in a field reference made through the root context passed to a
+// template definition, such as 1 for ".context.Values.replicaCount", or 0 if there is none.  Helpers commonly receive
+// the root context as an entry of a dictionary, i.e. "include "x" (dict "value" .Values.x "context" $)".
+func rootContextArgumentReference(ident []string) int {
+	if !inMacro() || isHelmBuiltinObjectReference(ident) {
+		return 0
+	}
+	for i := 1; i < len(ident)-1; i++ {
+		if helmBuiltinObjects[ident[i]] {
+			return i
+		}
+	}
+	return 0
+}
+
+// Converts the fields of a reference to the chart's values, such as ["Values", "baseDomain"], to snake_case when
+// ReplaceWithSnakeCase is set.  The fields are converted in place.
+func snakeCaseValuesFields(fields []string) []string {
+	if len(fields) > 0 && "."+fields[0] == valuesPrefix {
+		snakeCaseFields(fields[1:])
+	}
+	return fields
+}
+
+// Converts fields nested within the chart's values to snake_case when ReplaceWithSnakeCase is set.  The fields are
+// converted in place.
+func snakeCaseFields(fields []string) []string {
+	if ReplaceWithSnakeCase {
+		for i := range fields {
+			fields[i] = paramconv.ToSnake(fields[i])
+		}
+	}
+	return fields
+}
+
+// Writes a chain of fields relative to the "." of a scope.  References to Helm builtin objects are always written
+// globally, and the fields of the release, chart and template are written as their role variables.  Since the root
+// context is global, so are references to the builtin objects of a root context passed to a template definition.
+// Fields relative to a "." bound to the chart's values are converted to snake_case, as the defaults are.
+func writeFieldsTo(sb *strings.Builder, s scope, ident []string) {
+	if i := rootContextArgumentReference(ident); i > 0 {
+		logrus.Infof("Field %s refers to the root context passed to a template definition, and is written globally",
+			strings.Join(ident, "."))
+		ident = snakeCaseValuesFields(append([]string{}, ident[i:]...))
+	}
+	if variable, n := builtinObjectVariable(ident); n > 0 {
+		sb.WriteString(variable)
+		ident = ident[n:]
+	} else if s.dot != "" && !isHelmBuiltinObjectReference(ident) {
+		sb.WriteString(s.dot)
+		if s.values {
+			ident = snakeCaseFields(append([]string{}, ident...))
+		}
+	}
+	for i, id := range ident {
+		// Top-level values become Ansible variables, rather than keys of a dictionary.
+		if i == 1 && "."+ident[0] == valuesPrefix && isJinja2Identifier(id) {
+			sb.WriteString("." + id)
+			continue
+		}
+		writeFieldKeyTo(sb, id)
+	}
+}
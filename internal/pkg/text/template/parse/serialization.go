@@ -0,0 +1,59 @@
+package parse
+
+// Most charts emit nested values as YAML, indenting the result to the depth of the enclosing key:
+//
+// resources:
+//   {{- toYaml .Values.resources | nindent 12 }}
+//
+// Ansible's "to_nice_yaml" and Jinja2's "indent" filters cover the same ground, but their output differs from Helm's in
+// a few ways which change the rendered manifests.  These functions are rewritten as follows:
+//
+// toYaml v         ->  v | to_nice_yaml(indent=2, width=2147483647) | regex_replace('\n([.]{3}\n)?$', '')
+// toJson v         ->  v | to_json(sort_keys=True, separators=(',', ':'))
+// indent n s       ->  s | indent(n, first=True, blank=True)
+// nindent n s      ->  '\n' ~ s | indent(n, first=True, blank=True)
+//
+// Helm trims the trailing newline of the YAML document, whereas PyYAML terminates it, and terminates a document
+// consisting of a lone scalar with "...".  PyYAML also folds long strings at 80 columns unless the width is raised.
+// Both sort the keys of a YAML mapping.  Go's JSON encoder sorts keys and omits white space between tokens.  Sprig
+// indents every line, including the first and blank lines, which Jinja2 only does when asked to.  The remaining
+// serialization functions, such as "fromYaml" and "toPrettyJson", translate to filters of the same behaviour, and are
+// declared in FilterMappings.
+
+func translateToYAML(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	expression := parenthesize(operands[0]) + " | to_nice_yaml(indent=2, width=2147483647)" +
+		` | regex_replace('\n([.]{3}\n)?$', '')`
+	return &expression
+}
+
+func translateToJSON(operands []string) *string {
+	if len(operands) != 1 {
+		return nil
+	}
+	expression := parenthesize(operands[0]) + " | to_json(sort_keys=True, separators=(',', ':'))"
+	return &expression
+}
+
+func translateIndent(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	return indentation(operands[0], operands[1])
+}
+
+func translateNindent(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	expression := `'\n' ~ ` + *indentation(operands[0], operands[1])
+	return &expression
+}
+
+// Indents every line of a string by the given width, as Sprig does.
+func indentation(width string, s string) *string {
+	expression := parenthesize(s) + " | indent(" + width + ", first=True, blank=True)"
+	return &expression
+}
@@ -0,0 +1,93 @@
+package parse
+
+import (
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// Helm charts commonly roll a Deployment whenever one of its ConfigMaps or Secrets changes, by annotating the pod
+// template with the checksum of the rendered manifest:
+//
+// checksum/config: {{ include (print $.Template.BasePath "/configmap.yaml") . | sha256sum }}
+//
+// Rather than a template definition, "include" renders another template file of the chart here.  Every template file
+// is converted to a Jinja2 template within the Ansible Role templates directory, so the inclusion becomes a lookup of
+// the converted template:
+//
+// checksum/config: {{ lookup('template', 'configmap.yaml.j2') | hash('sha256') }}
+//
+// The lookup renders the template using the variables of the role, which correspond to the root context of the chart.
+
+// templateExtension is the extension of the converted templates within the Ansible Role templates directory.
+const templateExtension = ".j2"
+
+// templateBasePath is the builtin object holding the path of the chart's templates directory.
+var templateBasePath = []string{"Template", "BasePath"}
+
+// Determines whether the command is an "include" of another template file of the chart, such as:
+// {{ include (print $.Template.BasePath "/configmap.yaml") . }}
+func (c *CommandNode) isTemplateFileInclusion() bool {
+	if c.PipeNodeCount != 0 || len(c.Args) < 2 || len(c.Args) > 3 {
+		return false
+	}
+	identifier, ok := c.Args[0].(*IdentifierNode)
+	if !ok || identifier.Ident != includeFunction {
+		return false
+	}
+	_, ok = templateFilePath(c.Args[1])
+	return ok
+}
+
+// Returns the path of a template file relative to the templates directory, given the argument of an "include" which
+// prints the path starting from ".Template.BasePath".
+func templateFilePath(node Node) (string, bool) {
+	pipe, ok := node.(*PipeNode)
+	if !ok || len(pipe.Decl) != 0 || len(pipe.Cmds) != 1 {
+		return "", false
+	}
+	args := pipe.Cmds[0].Args
+	if len(args) < 3 {
+		return "", false
+	}
+	if identifier, ok := args[0].(*IdentifierNode); !ok || identifier.Ident != "print" || !isTemplateBasePath(args[1]) {
+		return "", false
+	}
+	var path strings.Builder
+	for _, arg := range args[2:] {
+		s, ok := arg.(*StringNode)
+		if !ok {
+			return "", false
+		}
+		path.WriteString(s.Text)
+	}
+	return strings.TrimPrefix(path.String(), "/"), true
+}
+
+// Determines whether a node is ".Template.BasePath" (or "$.Template.BasePath").
+func isTemplateBasePath(node Node) bool {
+	var ident []string
+	switch n := node.(type) {
+	case *FieldNode:
+		ident = n.Ident
+	case *VariableNode:
+		if len(n.Ident) == 0 || n.Ident[0] != goVariablePrefix {
+			return false
+		}
+		ident = n.Ident[1:]
+	default:
+		return false
+	}
+	return len(ident) == len(templateBasePath) && ident[0] == templateBasePath[0] && ident[1] == templateBasePath[1]
+}
+
+// Writes an "include" of another template file as a lookup of the converted template.
+func (c *CommandNode) writeTemplateFileLookup(sb *strings.Builder) {
+	path, _ := templateFilePath(c.Args[1])
+	if len(c.Args) == 3 && !isRootContext(c.Args[2]) {
+		logrus.Warnf("Template file \"%s\" is included with a context other than the root context, which the lookup "+
+			"doesn't pass: %s", path, c.Args[2])
+	}
+	lookup := "lookup('template', '" + path + templateExtension + "')"
+	logrus.Infof("Inclusion of template file \"%s\" converted to: %s", path, lookup)
+	sb.WriteString(lookup)
+}
@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"errors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+// Helm's "tpl" function renders a string as a template, which lets the values of a chart hold template syntax:
+//
+// podAnnotations:
+//   release: "{{ .Release.Name }}"
+//
+// {{ tpl (toYaml .Values.podAnnotations) . }}
+//
+// The strings are converted to Jinja2 at export time, both in defaults/main.yml and when they are passed to "tpl" as a
+// literal, and "tpl" becomes a lookup of a template which renders the string at runtime:
+//
+// {{ lookup('template', '_tpl.j2', template_vars={'tpl_string': pod_annotations | to_nice_yaml(...)}) }}
+//
+// Ansible templates the variables referenced while rendering, so the template simply references the string.  Strings
+// built at runtime, or passed to a template definition, can't be converted beforehand, and must already hold Jinja2.
+// The string is rendered with the role variables, which correspond to the root context of the chart.
+
+// TemplateStringFileName is the name of the template, within the Ansible Role templates directory, which renders the
+// strings passed to "tpl".
+const TemplateStringFileName = "_tpl.j2"
+
+// templateStringVariable is the variable holding the string rendered by the template string file.
+const templateStringVariable = "tpl_string"
+
+// TemplateStringTemplate is the contents of the template string file.
+const TemplateStringTemplate = "{{ " + templateStringVariable + " }}"
+
+// TranslateTemplateString translates a string holding Go template syntax, such as a value rendered by "tpl", into
+// Jinja2.  Template definitions can't be invoked while the string is rendered, so strings which define or include them
+// aren't translated.
+func TranslateTemplateString(text string) (string, error) {
+	funcs := map[string]interface{}{}
+	for name := range FilterMappings {
+		funcs[name] = name
+	}
+	// The string is rendered with the root context, regardless of the scope of the "tpl" invocation.
+	enclosingScopes := scopes
+	scopes = nil
+	defer func() { scopes = enclosingScopes }()
+	const name = "tpl"
+	trees, err := Parse(name, text, "", "", funcs)
+	if err != nil {
+		return "", err
+	}
+	if len(trees) > 1 {
+		return "", errors.New("the string defines templates")
+	}
+	tree, ok := trees[name]
+	if !ok {
+		return text, nil
+	}
+	translated := tree.Root.String()
+	if tree.callsMacros {
+		return "", errors.New("the string includes template definitions")
+	}
+	return translated, nil
+}
+
+// The writer of "tpl" translates template strings, which consults the filter mappings, so it can't be registered where
+// the mappings are initialized.
+func init() {
+	FilterMappings["tpl"] = rewrittenBy(translateTpl)
+}
+
+func translateTpl(operands []string) *string {
+	if len(operands) != 2 {
+		return nil
+	}
+	text, context := operands[0], operands[1]
+	if literal, err := strconv.Unquote(text); err == nil {
+		translated, err := TranslateTemplateString(literal)
+		if err != nil {
+			logrus.Warnf("Template string %s passed to \"tpl\" couldn't be converted to Jinja2, and is rendered as is: "+
+				"%s", text, err)
+		} else {
+			text = jinja2String(translated)
+		}
+	} else if !strings.HasPrefix(text, valuesPrefix+".") {
+		logrus.Warnf("Template string %s passed to \"tpl\" is rendered at runtime, and must hold Jinja2 syntax;  only "+
+			"the strings of values.yaml and literals are converted", text)
+	}
+	if context != "." && context != rootContextVariable {
+		logrus.Warnf("Template string %s passed to \"tpl\" is rendered with the role variables, rather than with the "+
+			"context %s", text, context)
+	}
+	expression := "lookup('template', '" + TemplateStringFileName + "', template_vars={'" + templateStringVariable +
+		"': " + text + "})"
+	return &expression
+}
@@ -0,0 +1,3 @@
+{{- define "collections.labels" -}}
+{{- toYaml .value -}}
+{{- end -}}
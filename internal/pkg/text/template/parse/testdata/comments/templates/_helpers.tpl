@@ -0,0 +1,15 @@
+{{/* vim: set filetype=mustache: */}}
+{{/*
+Expand the name of the chart.
+*/}}
+{{- define "comments.name" -}}
+{{ .Chart.Name }}
+{{- end -}}
+
+{{/*
+Common labels; callers pass the root context.
+*/}}
+{{- define "comments.labels" -}}
+{{- /* The chart label includes the version. */ -}}
+app.kubernetes.io/name: {{ include "comments.name" . }}
+{{- end -}}
@@ -0,0 +1,3 @@
+{{- define "range_scopes.url" -}}
+http://{{ .name }}:{{ .port }}
+{{- end }}
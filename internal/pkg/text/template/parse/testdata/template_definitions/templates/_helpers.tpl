@@ -0,0 +1,7 @@
+{{/* Expand the name of the chart. */}}
+{{ define "definitions.name" }}{{ default .Chart.Name .Values.nameOverride }}{{ end }}
+
+{{ define "definitions.labels" }}
+app.kubernetes.io/name: {{ include "definitions.name" . }}
+app.kubernetes.io/instance: {{ .Release.Name }}
+{{ end }}
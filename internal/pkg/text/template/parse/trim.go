@@ -0,0 +1,75 @@
+package parse
+
+import "strings"
+
+// Go templates and Jinja2 share the same whitespace trimming syntax;  a "-" adjacent to a delimiter trims all trailing
+// (for "{{-") or leading (for "-}}") whitespace of the neighbouring text.  The lexer still trims the whitespace as the
+// Go template lexer would, but records which delimiters carried a marker so the writers can reproduce the marker on
+// the corresponding Jinja2 delimiter.  For example:
+//
+// {{- if .Values.enabled }}
+// enabled: true
+// {{- end }}
+//
+// becomes:
+//
+// {%- if .Values.enabled %}
+// enabled: true
+// {%- endif %}
+//
+// Since the markers are preserved, the converted template must be rendered with the Jinja2 "trim_blocks" option
+// disabled, otherwise Jinja2 removes newlines that Helm keeps.
+
+const expressionLeftDelim = "{{"
+const expressionRightDelim = "}}"
+const statementLeftDelim = "{%"
+const statementRightDelim = "%}"
+const trimMarker = "-"
+
+// TrimMarkers records whether the left and right delimiters of an action carried a trim marker.
+type TrimMarkers struct {
+	Left  bool // Whether the action opened with "{{- ".
+	Right bool // Whether the action closed with " -}}".
+}
+
+// BranchTrimMarkers records the trim markers of each action making up a control structure.
+type BranchTrimMarkers struct {
+	Open TrimMarkers // The "if", "range" or "with" action.
+	Else TrimMarkers // The "else" action, if any.
+	End  TrimMarkers // The "end" action.
+}
+
+// Writes a left delimiter followed by a space, such as "{{ " or "{%- ".
+func (m TrimMarkers) writeLeftTo(sb *strings.Builder, delim string) {
+	sb.WriteString(delim)
+	if m.Left {
+		sb.WriteString(trimMarker)
+	}
+	sb.WriteByte(' ')
+}
+
+// Writes a space followed by a right delimiter, such as " }}" or " -%}".
+func (m TrimMarkers) writeRightTo(sb *strings.Builder, delim string) {
+	sb.WriteByte(' ')
+	if m.Right {
+		sb.WriteString(trimMarker)
+	}
+	sb.WriteString(delim)
+}
+
+// Writes a complete Jinja2 statement, such as "{%- else %}".
+func (m TrimMarkers) writeStatementTo(sb *strings.Builder, statement string) {
+	m.writeLeftTo(sb, statementLeftDelim)
+	sb.WriteString(statement)
+	m.writeRightTo(sb, statementRightDelim)
+}
+
+// Records the trim marker of a delimiter consumed by the parser.
+func (t *Tree) recordTrimMarker(token item) {
+	switch token.typ {
+	case itemLeftDelim:
+		t.trim.Left = token.trim
+	case itemRightDelim:
+		t.trim.Right = token.trim
+	}
+}
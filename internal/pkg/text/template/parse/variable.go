@@ -0,0 +1,141 @@
+package parse
+
+import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
+	"strings"
+)
+
+// Go template variables are lexically scoped to the enclosing control structure, and a variable assigned within a
+// "range" body is visible after the loop ends.  Jinja2 "for" loops introduce their own scope;  a "set" within a loop
+// body is discarded once the iteration finishes.  Thus, a variable which is declared outside of a "range" and
+// reassigned within it is stored in a namespace() object, whose attributes may be set from within a loop.  For example:
+//
+// {{ $found := false }}
+// {{ range .Values.hosts }}{{ $found = true }}{{ end }}
+// {{ $found }}
+//
+// becomes:
+//
+// {% set var_found = namespace(value=false) %}
+// {% for item_hosts in .Values.hosts %}{% set var_found.value = true %}{% endfor %}
+// {{ var_found.value }}
+//
+// Variables are prefixed, just as the loop items of a "range" and the aliases of a "with" are, since the chart's values
+// are top-level role variables;  "{% set name = ... %}" would shadow the "name" value.
+
+const goVariablePrefix = "$"
+const jinja2VariablePrefix = "var_"
+const namespaceAttribute = "value"
+const rootContextVariable = "vars"
+
+// Translates a Go template variable name (i.e., "$fullName") into a Jinja2 variable name (i.e., "var_fullName", or
+// "var_full_name" when ReplaceWithSnakeCase is set).
+func variableName(ident string) string {
+	name := strings.TrimPrefix(ident, goVariablePrefix)
+	if ReplaceWithSnakeCase {
+		name = paramconv.ToSnake(name)
+	}
+	return jinja2VariablePrefix + name
+}
+
+// Determines whether the named variable must be stored in a namespace() object.  The variables of a tree are analyzed
+// the first time this is called.
+func (t *Tree) isNamespacedVariable(name string) bool {
+	if t == nil || t.Root == nil {
+		return false
+	}
+	if t.namespacedVariables == nil {
+		t.namespacedVariables = map[string]bool{}
+		findNamespacedVariables(t.Root, 0, map[string]int{}, t.namespacedVariables)
+	}
+	return t.namespacedVariables[name]
+}
+
+// Records which variables are assigned within a deeper "range" than the one they are declared in.  declarations maps
+// each variable in scope to the loop depth it was declared at.
+func findNamespacedVariables(node Node, depth int, declarations map[string]int, namespaced map[string]bool) {
+	switch n := node.(type) {
+	case *ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			findNamespacedVariables(child, depth, declarations, namespaced)
+		}
+	case *ActionNode:
+		for _, v := range n.Pipe.Decl {
+			name := v.Ident[0]
+			if !n.Pipe.IsAssign {
+				declarations[name] = depth
+			} else if declared, ok := declarations[name]; ok && declared < depth {
+				namespaced[name] = true
+			}
+		}
+	case *IfNode:
+		findNamespacedVariables(n.List, depth, declarations, namespaced)
+		findNamespacedVariables(n.ElseList, depth, declarations, namespaced)
+	case *WithNode:
+		for _, v := range n.Pipe.Decl {
+			declarations[v.Ident[0]] = depth
+		}
+		findNamespacedVariables(n.List, depth, declarations, namespaced)
+		findNamespacedVariables(n.ElseList, depth, declarations, namespaced)
+	case *RangeNode:
+		// Declarations within the loop body shadow, rather than replace, the enclosing declarations.
+		loopDeclarations := make(map[string]int, len(declarations))
+		for name, declared := range declarations {
+			loopDeclarations[name] = declared
+		}
+		for _, v := range n.Pipe.Decl {
+			loopDeclarations[v.Ident[0]] = depth + 1
+		}
+		findNamespacedVariables(n.List, depth+1, loopDeclarations, namespaced)
+		findNamespacedVariables(n.ElseList, depth, declarations, namespaced)
+	}
+}
+
+// Writes a variable declaration or assignment action as a Jinja2 "set" statement.  For example, "{{ $name := .Values.x }}"
+// becomes "{% set var_name = .Values.x %}".
+func (a *ActionNode) writeVariableDeclarationTo(sb *strings.Builder) {
+	variable := a.Pipe.Decl[0]
+	name := variableName(variable.Ident[0])
+	namespaced := a.tr.isNamespacedVariable(variable.Ident[0])
+	a.Trim.writeLeftTo(sb, statementLeftDelim)
+	sb.WriteString("set ")
+	sb.WriteString(name)
+	if namespaced && a.Pipe.IsAssign {
+		sb.WriteString("." + namespaceAttribute)
+	}
+	sb.WriteString(" = ")
+	a.tr.declaredVariable, a.tr.declaredCommand = name, a.Pipe.Cmds[0]
+	defer func() { a.tr.declaredVariable, a.tr.declaredCommand = "", nil }()
+	if namespaced && !a.Pipe.IsAssign {
+		sb.WriteString("namespace(" + namespaceAttribute + "=")
+		a.Pipe.writeExpressionTo(sb)
+		sb.WriteString(")")
+	} else {
+		a.Pipe.writeExpressionTo(sb)
+	}
+	a.Trim.writeRightTo(sb, statementRightDelim)
+}
+
+// Writes a reference to the root context ("$").  Go binds "$" to the data passed to the template, which is either the
+// root of a Helm template or the argument of a template definition, regardless of any enclosing "range" or "with".
+// Thus, fields of "$" are written as if "." were bound to the root, and "$.Values.replicaCount" resolves to the same
+// Ansible variable as ".Values.replicaCount" does outside of any rebinding.  Ansible has no root context object, so
+// outside of template definitions "$" alone is written as the "vars" dictionary, its closest equivalent.  When it is
+// passed to a template definition, such as "dict "context" $", its builtin objects are written globally within the
+// macro (see writeFieldsTo), so the dictionary itself is never read.
+func (v *VariableNode) writeRootReferenceTo(sb *strings.Builder) {
+	root := rootScope()
+	fields := append([]string{}, v.Ident[1:]...)
+	if len(fields) == 0 {
+		if root.dot != "" {
+			sb.WriteString(root.dot)
+		} else {
+			sb.WriteString(rootContextVariable)
+		}
+		return
+	}
+	writeFieldsTo(sb, root, snakeCaseValuesFields(fields))
+}
@@ -1,27 +1,46 @@
 package parse
 
 import (
+	"github.com/operator-framework/operator-sdk/pkg/ansible/paramconv"
 	"github.com/sirupsen/logrus"
+	"strconv"
 	"strings"
 )
 
+const withAliasPrefix = "with_"
+const withDefaultAliasName = "value"
+
 // WithNode is the representation of a "with" statement.  This is a tailored version of text/template's BranchNode.
 // The text/template package "if", "for" and "with" utilizing the BranchNode abstraction.  This makes sense, since the
 // types are all very similar in Go Templating, and they are all output in very similar manners.  However, Jinja2 has
 // greater requirements surrounding output of these Branch structures. This abstraction is introduced to handle the
 // "with" BranchNode.
 //
-// Currently, the implementation outputs go template code, as Ansible does not support the "with" block.  A warning
-// including the source line number is emitted to the user that a manual conversion is required.  In the future, this
-// should be improved to support a more automated form of conversion.
+// Jinja2 has no equivalent to "with", which both guards on the value of the pipeline and rebinds "." to that value.
+// The translation makes both steps explicit;  the pipeline is guarded by an "if", and the value is bound to an alias
+// using "set".  "." references within the body are then written in terms of the alias.  For example:
+//
+// {{ with .Values.nodeSelector }}
+// nodeSelector: {{ toYaml . }}
+// {{ end }}
+//
+// becomes:
+//
+// {% if .Values.node_selector is defined and .Values.node_selector %}{% set with_node_selector = .Values.node_selector %}
+// nodeSelector: {{ with_node_selector | toYaml }}
+// {% endif %}
+//
+// If the "with" declares a variable (i.e., "{{ with $selector := .Values.nodeSelector }}"), the variable is used as the
+// alias.  Go leaves "." unaffected in the "else" branch, so the "else" branch is written in the enclosing scope.
 type WithNode struct {
 	NodeType
 	Pos
 	tr       *Tree
-	Line     int           // The line number in the input. Deprecated: Kept for compatibility.
-	Pipe     *WithPipeNode // The *with* pipeline to be evaluated.
-	List     *ListNode     // What to execute if the value is non-empty.
-	ElseList *ListNode     // What to execute if the value is empty (nil if absent).
+	Line     int               // The line number in the input. Deprecated: Kept for compatibility.
+	Pipe     *WithPipeNode     // The *with* pipeline to be evaluated.
+	List     *ListNode         // What to execute if the value is non-empty.
+	ElseList *ListNode         // What to execute if the value is empty (nil if absent).
+	Trim     BranchTrimMarkers // The trim markers of the "with", "else" and "end" actions.
 }
 
 func (w *WithNode) String() string {
@@ -31,19 +50,62 @@ func (w *WithNode) String() string {
 }
 
 func (w *WithNode) writeTo(sb *strings.Builder) {
-	// TODO:  This implementation will not work in Ansible.  This is not a regression;  no existing solution has
-	// handled with appropriately.
-	logrus.Warnf("\"with\" block on line %d outputting as in Go Template format;  manual conversion required",
-		w.Line)
-	sb.WriteString("{% with ")
-	w.Pipe.writeTo(sb)
-	sb.WriteString(" %}")
+	expression := w.Pipe.expressionString()
+	alias := w.alias()
+	values := w.Pipe.isReference() && isValuesReference(w.Pipe.Cmds[0].Args[0])
+	logrus.Infof("\"with\" block on line %d bound to alias: %s", w.Line, alias)
+
+	w.Trim.Open.writeLeftTo(sb, statementLeftDelim)
+	sb.WriteString("if ")
+	if w.Pipe.isReference() {
+		sb.WriteString(expression)
+		sb.WriteString(" is defined and ")
+	}
+	sb.WriteString(expression)
+	sb.WriteString(" %}{% set ")
+	sb.WriteString(alias)
+	sb.WriteString(" = ")
+	sb.WriteString(expression)
+	w.Trim.Open.writeRightTo(sb, statementRightDelim)
+	pushScope(scope{dot: alias, values: values})
 	w.List.writeTo(sb)
+	popScope()
 	if w.ElseList != nil {
-		sb.WriteString("{% else %}")
+		w.Trim.Else.writeStatementTo(sb, "else")
 		w.ElseList.writeTo(sb)
 	}
-	sb.WriteString("{% endwith %}")
+	w.Trim.End.writeStatementTo(sb, "endif")
+}
+
+// Derives the name of the Jinja2 variable the value of the "with" pipeline is bound to.  A declared variable is
+// translated as any other variable is;  otherwise, the name is derived from the last field of the pipeline, such as
+// "with_node_selector" for ".Values.nodeSelector" when ReplaceWithSnakeCase is set.  If an enclosing scope is already
+// bound to the same name, the nesting depth is appended so the enclosing alias isn't clobbered.
+func (w *WithNode) alias() string {
+	if len(w.Pipe.Decl) > 0 {
+		return variableName(w.Pipe.Decl[0].Ident[0])
+	}
+	name := withDefaultAliasName
+	if len(w.Pipe.Cmds) == 1 && len(w.Pipe.Cmds[0].Args) == 1 {
+		switch arg := w.Pipe.Cmds[0].Args[0].(type) {
+		case *FieldNode:
+			name = arg.Ident[len(arg.Ident)-1]
+		case *ChainNode:
+			name = arg.Field[len(arg.Field)-1]
+		case *VariableNode:
+			name = strings.TrimPrefix(arg.Ident[len(arg.Ident)-1], "$")
+		}
+	}
+	if ReplaceWithSnakeCase {
+		name = paramconv.ToSnake(name)
+	}
+	alias := withAliasPrefix + name
+	for _, s := range scopes {
+		if s.dot == alias {
+			return alias + "_" + strconv.Itoa(len(scopes))
+		}
+	}
+	return alias
 }
 
 func (t *Tree) newWith(pos Pos, line int, pipe *WithPipeNode, list, elseList *ListNode) *WithNode {
@@ -51,7 +113,9 @@ func (t *Tree) newWith(pos Pos, line int, pipe *WithPipeNode, list, elseList *Li
 }
 
 func (w *WithNode) Copy() Node {
-	return w.tr.newWith(w.Pos, w.Line, w.Pipe.CopyPipe(), w.List.CopyList(), w.ElseList.CopyList())
+	copied := w.tr.newWith(w.Pos, w.Line, w.Pipe.CopyPipe(), w.List.CopyList(), w.ElseList.CopyList())
+	copied.Trim = w.Trim
+	return copied
 }
 
 func (w *WithNode) tree() *Tree {
@@ -39,12 +39,33 @@ func (p *WithPipeNode) writeTo(sb *strings.Builder) {
 		}
 		sb.WriteString(" := ")
 	}
-	for i, c := range p.Cmds {
-		if i > 0 {
-			sb.WriteString(" | ")
-		}
-		c.writeTo(sb)
+	p.writeExpressionTo(sb)
+}
+
+// Writes the commands of the pipeline, omitting any variable declaration.
+func (p *WithPipeNode) writeExpressionTo(sb *strings.Builder) {
+	writePipelineTo(sb, commandNodes(p.Cmds))
+}
+
+func (p *WithPipeNode) expressionString() string {
+	var sb strings.Builder
+	p.writeExpressionTo(&sb)
+	return sb.String()
+}
+
+// Determines whether the pipeline is a plain reference to a value (i.e., ".Values.nodeSelector"), which Ansible
+// requires to be checked for definition before it can be evaluated.
+func (p *WithPipeNode) isReference() bool {
+	if len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch arg := p.Cmds[0].Args[0].(type) {
+	case *FieldNode, *ChainNode:
+		return true
+	case *VariableNode:
+		return len(arg.Ident) > 1
 	}
+	return false
 }
 
 func (p *WithPipeNode) tree() *Tree {